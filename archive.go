@@ -0,0 +1,312 @@
+package main
+
+import (
+	"archive/tar"
+	"archive/zip"
+	"bufio"
+	"compress/gzip"
+	"fmt"
+	"io"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+
+	"github.com/saracen/go7z"
+	"github.com/ulikunitz/xz"
+)
+
+// A file or directory read from an archive, Name always uses forward slashes
+type ArchiveEntry struct {
+	Name  string
+	Mode  os.FileMode
+	IsDir bool
+	// Link is set for symbolic and hard links, they are never extracted
+	Link string
+}
+
+// Reads the entries of an archive in order, the contents of an entry can be read from the returned reader until the next call to Next
+type ArchiveReader interface {
+	Next() (*ArchiveEntry, io.Reader, error)
+	Close() error
+}
+
+// Opens an archive, the format is picked by the file extension
+func OpenArchive(source string) (ArchiveReader, error) {
+	name := strings.ToLower(source)
+	switch {
+	case strings.HasSuffix(name, ".7z"):
+		return open7zArchive(source)
+	case strings.HasSuffix(name, ".zip"):
+		return openZipArchive(source)
+	case strings.HasSuffix(name, ".tar.gz"), strings.HasSuffix(name, ".tgz"):
+		return openTarArchive(source, func(r io.Reader) (io.Reader, error) {
+			return gzip.NewReader(r)
+		})
+	case strings.HasSuffix(name, ".tar.xz"), strings.HasSuffix(name, ".txz"):
+		return openTarArchive(source, func(r io.Reader) (io.Reader, error) {
+			return xz.NewReader(r)
+		})
+	}
+
+	return nil, fmt.Errorf("Unsupported archive format: %s", filepath.Base(source))
+}
+
+type sevenZipArchive struct {
+	sz *go7z.ReadCloser
+}
+
+func open7zArchive(source string) (ArchiveReader, error) {
+	sz, err := go7z.OpenReader(source)
+	if err != nil {
+		return nil, err
+	}
+	return &sevenZipArchive{sz: sz}, nil
+}
+
+func (a *sevenZipArchive) Next() (*ArchiveEntry, io.Reader, error) {
+	hdr, err := a.sz.Next()
+	if err != nil {
+		return nil, nil, err
+	}
+
+	entry := &ArchiveEntry{
+		Name: strings.ReplaceAll(hdr.Name, "\\", "/"),
+		Mode: 0644,
+		// If empty stream (no contents) and isn't specifically an empty file...
+		// then it's a directory.
+		IsDir: hdr.IsEmptyStream && !hdr.IsEmptyFile,
+	}
+
+	// archives made on unix keep the file mode in the high 16 bits of the attributes
+	if hdr.Attrib&0x8000 != 0 {
+		entry.Mode = os.FileMode(hdr.Attrib>>16) & os.ModePerm
+	}
+
+	return entry, a.sz, nil
+}
+
+func (a *sevenZipArchive) Close() error {
+	return a.sz.Close()
+}
+
+type zipArchive struct {
+	zr      *zip.ReadCloser
+	index   int
+	current io.ReadCloser
+}
+
+func openZipArchive(source string) (ArchiveReader, error) {
+	zr, err := zip.OpenReader(source)
+	if err != nil {
+		return nil, err
+	}
+	return &zipArchive{zr: zr}, nil
+}
+
+func (a *zipArchive) Next() (*ArchiveEntry, io.Reader, error) {
+	if a.current != nil {
+		a.current.Close()
+		a.current = nil
+	}
+
+	if a.index >= len(a.zr.File) {
+		return nil, nil, io.EOF
+	}
+	file := a.zr.File[a.index]
+	a.index++
+
+	entry := &ArchiveEntry{
+		Name:  file.Name,
+		Mode:  file.Mode().Perm(),
+		IsDir: file.FileInfo().IsDir(),
+	}
+	if file.Mode()&os.ModeSymlink != 0 {
+		entry.Link = file.Name
+	}
+	if entry.IsDir || entry.Link != "" {
+		return entry, strings.NewReader(""), nil
+	}
+
+	rc, err := file.Open()
+	if err != nil {
+		return nil, nil, err
+	}
+	a.current = rc
+
+	return entry, rc, nil
+}
+
+func (a *zipArchive) Close() error {
+	if a.current != nil {
+		a.current.Close()
+	}
+	return a.zr.Close()
+}
+
+type tarArchive struct {
+	file *os.File
+	tr   *tar.Reader
+}
+
+func openTarArchive(source string, decompress func(io.Reader) (io.Reader, error)) (ArchiveReader, error) {
+	file, err := os.Open(source)
+	if err != nil {
+		return nil, err
+	}
+
+	r, err := decompress(bufio.NewReader(file))
+	if err != nil {
+		file.Close()
+		return nil, err
+	}
+
+	return &tarArchive{file: file, tr: tar.NewReader(r)}, nil
+}
+
+func (a *tarArchive) Next() (*ArchiveEntry, io.Reader, error) {
+	for {
+		hdr, err := a.tr.Next()
+		if err != nil {
+			return nil, nil, err
+		}
+
+		entry := &ArchiveEntry{Name: hdr.Name, Mode: hdr.FileInfo().Mode().Perm()}
+		switch hdr.Typeflag {
+		case tar.TypeDir:
+			entry.IsDir = true
+		case tar.TypeSymlink, tar.TypeLink:
+			entry.Link = hdr.Linkname
+		case tar.TypeReg, tar.TypeRegA:
+		default:
+			// devices, fifos and pax headers have nothing for us
+			continue
+		}
+
+		return entry, a.tr, nil
+	}
+}
+
+func (a *tarArchive) Close() error {
+	return a.file.Close()
+}
+
+type ExtractOptions struct {
+	// StripPrefix is removed from the entry names, usually the root directory of the archive
+	StripPrefix string
+	// Filters are name prefixes to extract, everything is extracted when there are none
+	Filters []string
+	// Flatten puts every file directly in the destination directory
+	Flatten bool
+}
+
+func (o ExtractOptions) matches(name string) bool {
+	if len(o.Filters) == 0 {
+		return true
+	}
+	for _, filter := range o.Filters {
+		if strings.HasPrefix(name, filter) {
+			Debugf("%s matches filter %s", name, filter)
+			return true
+		}
+	}
+	return false
+}
+
+// Joins an entry name to the destination, names that would end up outside of it are rejected
+func SafeArchivePath(dest, name string) (string, error) {
+	slashed := strings.ReplaceAll(name, "\\", "/")
+	if strings.HasPrefix(slashed, "/") || filepath.IsAbs(name) || filepath.VolumeName(name) != "" {
+		return "", fmt.Errorf("Archive entry %q has an absolute path", name)
+	}
+
+	for _, part := range strings.Split(slashed, "/") {
+		if part == ".." {
+			return "", fmt.Errorf("Archive entry %q escapes the destination directory", name)
+		}
+	}
+
+	return filepath.Join(dest, filepath.FromSlash(slashed)), nil
+}
+
+// Extracts the matching entries of an archive into dest, links are skipped and modes are kept
+func ExtractArchive(source, dest string, options ExtractOptions) error {
+	archive, err := OpenArchive(source)
+	if err != nil {
+		return err
+	}
+	defer archive.Close()
+
+	for {
+		entry, r, err := archive.Next()
+		if err == io.EOF {
+			break // End of archive
+		}
+		if err != nil {
+			return err
+		}
+
+		// remove root directory from path
+		name := strings.TrimPrefix(entry.Name, options.StripPrefix)
+		if name == "" || !options.matches(name) {
+			continue
+		}
+
+		if entry.Link != "" {
+			Debugf("Skipping link %s -> %s", entry.Name, entry.Link)
+			continue
+		}
+
+		if options.Flatten {
+			if entry.IsDir {
+				continue
+			}
+			name = path.Base(name)
+		}
+
+		p, err := SafeArchivePath(dest, name)
+		if err != nil {
+			return err
+		}
+
+		if entry.IsDir {
+			err = os.MkdirAll(p, os.ModePerm)
+			if err != nil {
+				return err
+			}
+			continue
+		}
+
+		err = extractArchiveFile(p, entry.Mode, r)
+		if err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// Writes a single file, it is closed before the next entry is read
+func extractArchiveFile(p string, mode os.FileMode, r io.Reader) error {
+	err := os.MkdirAll(filepath.Dir(p), os.ModePerm)
+	if err != nil {
+		return err
+	}
+
+	// Create file, keeping the mode so executables stay executable
+	f, err := os.OpenFile(p, os.O_CREATE|os.O_WRONLY|os.O_TRUNC, mode|0600)
+	if err != nil {
+		return err
+	}
+
+	_, err = io.Copy(f, r)
+	if closeErr := f.Close(); err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		return err
+	}
+
+	// OpenFile only applies the mode to new files and the umask still applies to it
+	return os.Chmod(p, mode|0600)
+}
@@ -0,0 +1,270 @@
+package main
+
+import (
+	"archive/tar"
+	"archive/zip"
+	"compress/gzip"
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"testing"
+
+	"github.com/ulikunitz/xz"
+)
+
+type testArchiveEntry struct {
+	name    string
+	content string
+	mode    os.FileMode
+	dir     bool
+	link    string
+}
+
+var testArchiveFormats = []string{".zip", ".tar.gz", ".tar.xz"}
+
+// Writes a zip, tar.gz or tar.xz archive, the format is picked by the extension like OpenArchive does
+func writeTestArchive(t *testing.T, archivePath string, entries []testArchiveEntry) {
+	t.Helper()
+
+	f, err := os.Create(archivePath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+
+	if strings.HasSuffix(archivePath, ".zip") {
+		zw := zip.NewWriter(f)
+		for _, entry := range entries {
+			header := &zip.FileHeader{Name: entry.name, Method: zip.Deflate}
+			content := entry.content
+			switch {
+			case entry.dir:
+				header.SetMode(os.ModeDir | 0755)
+			case entry.link != "":
+				header.SetMode(os.ModeSymlink | 0777)
+				content = entry.link
+			default:
+				header.SetMode(entry.mode)
+			}
+			w, err := zw.CreateHeader(header)
+			if err != nil {
+				t.Fatal(err)
+			}
+			io.WriteString(w, content)
+		}
+		if err := zw.Close(); err != nil {
+			t.Fatal(err)
+		}
+		return
+	}
+
+	var compressed io.WriteCloser
+	if strings.HasSuffix(archivePath, ".tar.xz") {
+		compressed, err = xz.NewWriter(f)
+		if err != nil {
+			t.Fatal(err)
+		}
+	} else {
+		compressed = gzip.NewWriter(f)
+	}
+	tw := tar.NewWriter(compressed)
+	for _, entry := range entries {
+		header := &tar.Header{Name: entry.name, Mode: int64(entry.mode), Size: int64(len(entry.content)), Typeflag: tar.TypeReg}
+		switch {
+		case entry.dir:
+			header.Typeflag = tar.TypeDir
+			header.Mode = 0755
+			header.Size = 0
+		case entry.link != "":
+			header.Typeflag = tar.TypeSymlink
+			header.Linkname = entry.link
+			header.Size = 0
+		}
+		if err := tw.WriteHeader(header); err != nil {
+			t.Fatal(err)
+		}
+		if header.Size > 0 {
+			io.WriteString(tw, entry.content)
+		}
+	}
+	if err := tw.Close(); err != nil {
+		t.Fatal(err)
+	}
+	if err := compressed.Close(); err != nil {
+		t.Fatal(err)
+	}
+}
+
+// Lists the files below dir with forward slashes, directories end with a slash
+func listExtracted(t *testing.T, dir string) []string {
+	t.Helper()
+
+	names := []string{}
+	filepath.Walk(dir, func(p string, info os.FileInfo, err error) error {
+		if err != nil || p == dir {
+			return err
+		}
+		rel, _ := filepath.Rel(dir, p)
+		rel = filepath.ToSlash(rel)
+		if info.IsDir() {
+			rel += "/"
+		}
+		names = append(names, rel)
+		return nil
+	})
+	sort.Strings(names)
+	return names
+}
+
+func TestSafeArchivePath(t *testing.T) {
+	dest := filepath.Join("out", "dest")
+	tests := []struct {
+		name     string
+		expected string
+	}{
+		{"bin/ffmpeg", filepath.Join(dest, "bin", "ffmpeg")},
+		{"a/./b", filepath.Join(dest, "a", "b")},
+		{"a/b/../c", ""},
+		{"../evil", ""},
+		{"a/../../evil", ""},
+		{"..\\evil", ""},
+		{"/etc/passwd", ""},
+		{"\\windows\\system32", ""},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			p, err := SafeArchivePath(dest, test.name)
+			if test.expected == "" {
+				if err == nil {
+					t.Errorf("expected %q to be rejected, got %s", test.name, p)
+				}
+				return
+			}
+			if err != nil || p != test.expected {
+				t.Errorf("got %q (%v), expected %q", p, err, test.expected)
+			}
+		})
+	}
+}
+
+func TestExtractArchiveRejectsTraversal(t *testing.T) {
+	for _, format := range testArchiveFormats {
+		for _, name := range []string{"../evil", "a/../../evil", "/tmp/evil"} {
+			t.Run(format+" "+name, func(t *testing.T) {
+				dir := t.TempDir()
+				archivePath := filepath.Join(dir, "archive"+format)
+				writeTestArchive(t, archivePath, []testArchiveEntry{
+					{name: name, content: "evil", mode: 0644},
+				})
+
+				dest := filepath.Join(dir, "dest")
+				err := ExtractArchive(archivePath, dest, ExtractOptions{})
+				if err == nil {
+					t.Fatal("expected the entry to be rejected")
+				}
+				if FileExists(filepath.Join(dir, "evil")) || FileExists("/tmp/evil") {
+					t.Error("the entry was written outside the destination")
+				}
+			})
+		}
+	}
+}
+
+func TestExtractArchiveSkipsLinks(t *testing.T) {
+	for _, format := range testArchiveFormats {
+		t.Run(format, func(t *testing.T) {
+			dir := t.TempDir()
+			archivePath := filepath.Join(dir, "archive"+format)
+			writeTestArchive(t, archivePath, []testArchiveEntry{
+				{name: "root/", dir: true},
+				{name: "root/passwd", link: "/etc/passwd"},
+				{name: "root/up", link: "../../.."},
+				{name: "root/file.txt", content: "text", mode: 0644},
+			})
+
+			dest := filepath.Join(dir, "dest")
+			err := ExtractArchive(archivePath, dest, ExtractOptions{})
+			if err != nil {
+				t.Fatal(err)
+			}
+			if got := strings.Join(listExtracted(t, dest), ","); got != "root/,root/file.txt" {
+				t.Errorf("got %s, links should have been skipped", got)
+			}
+		})
+	}
+}
+
+func TestExtractArchive(t *testing.T) {
+	entries := []testArchiveEntry{
+		{name: "ffmpeg-6.0/", dir: true},
+		{name: "ffmpeg-6.0/bin/", dir: true},
+		{name: "ffmpeg-6.0/bin/ffmpeg", content: "binary", mode: 0755},
+		{name: "ffmpeg-6.0/bin/ffprobe", content: "probe", mode: 0755},
+		{name: "ffmpeg-6.0/doc/readme.txt", content: "readme", mode: 0600},
+	}
+
+	tests := []struct {
+		name     string
+		options  ExtractOptions
+		expected []string
+	}{
+		{
+			name:     "everything",
+			expected: []string{"ffmpeg-6.0/", "ffmpeg-6.0/bin/", "ffmpeg-6.0/bin/ffmpeg", "ffmpeg-6.0/bin/ffprobe", "ffmpeg-6.0/doc/", "ffmpeg-6.0/doc/readme.txt"},
+		},
+		{
+			name:     "strip prefix",
+			options:  ExtractOptions{StripPrefix: "ffmpeg-6.0/"},
+			expected: []string{"bin/", "bin/ffmpeg", "bin/ffprobe", "doc/", "doc/readme.txt"},
+		},
+		{
+			name:     "filter",
+			options:  ExtractOptions{StripPrefix: "ffmpeg-6.0/", Filters: []string{"bin/ffmpeg", "doc/"}},
+			expected: []string{"bin/", "bin/ffmpeg", "doc/", "doc/readme.txt"},
+		},
+		{
+			name:     "flatten",
+			options:  ExtractOptions{StripPrefix: "ffmpeg-6.0/", Filters: []string{"bin/ffmpeg"}, Flatten: true},
+			expected: []string{"ffmpeg"},
+		},
+	}
+
+	for _, format := range testArchiveFormats {
+		for _, test := range tests {
+			t.Run(format+" "+test.name, func(t *testing.T) {
+				dir := t.TempDir()
+				archivePath := filepath.Join(dir, "archive"+format)
+				writeTestArchive(t, archivePath, entries)
+
+				dest := filepath.Join(dir, "dest")
+				err := ExtractArchive(archivePath, dest, test.options)
+				if err != nil {
+					t.Fatal(err)
+				}
+				if got := listExtracted(t, dest); strings.Join(got, ",") != strings.Join(test.expected, ",") {
+					t.Errorf("got %v, expected %v", got, test.expected)
+				}
+
+				// executables stay executable
+				ffmpeg := filepath.Join(dest, "ffmpeg-6.0", "bin", "ffmpeg")
+				switch {
+				case test.options.Flatten:
+					ffmpeg = filepath.Join(dest, "ffmpeg")
+				case test.options.StripPrefix != "":
+					ffmpeg = filepath.Join(dest, "bin", "ffmpeg")
+				}
+				info, err := os.Stat(ffmpeg)
+				if err != nil || info.Mode().Perm() != 0755 {
+					t.Errorf("got %v (%v), expected mode 0755", info, err)
+				}
+				data, _ := os.ReadFile(ffmpeg)
+				if string(data) != "binary" {
+					t.Errorf("got contents %q", data)
+				}
+			})
+		}
+	}
+}
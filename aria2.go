@@ -0,0 +1,168 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"regexp"
+	"runtime"
+	"strings"
+
+	"github.com/google/go-github/v43/github"
+)
+
+var aria2VersionRegex = regexp.MustCompile(`aria2 version (\S+)`)
+
+type Aria2Dependency struct {
+	Dir    string
+	Owner  string
+	Repo   string
+	GitHub *github.Client
+
+	// the release found by LatestVersion and its download URL
+	latestVersion string
+	latestUrl     string
+}
+
+func NewAria2Dependency() *Aria2Dependency {
+	return &Aria2Dependency{Dir: ARIA2_BIN_DIRECTORY, Owner: ARIA2_REPO_OWNER, Repo: ARIA2_REPO_NAME, GitHub: githubClient}
+}
+
+func (d *Aria2Dependency) Name() string {
+	return "aria2"
+}
+
+func (d *Aria2Dependency) BinaryPath() string {
+	if runtime.GOOS == "windows" {
+		return filepath.Join(d.Dir, "aria2c.exe")
+	}
+	return filepath.Join(d.Dir, "aria2c")
+}
+
+func (d *Aria2Dependency) Version(binary string) (string, error) {
+	return GetAria2Version(binary)
+}
+
+func (d *Aria2Dependency) Detect() (*DependencyInstall, error) {
+	// check if aria2 is installed externally
+	if CommandExists("aria2c") {
+		return detectSystemInstall("aria2c", GetAria2Version), nil
+	}
+
+	return detectManagedInstall(d.Dir, d.BinaryPath())
+}
+
+func (d *Aria2Dependency) LatestVersion() (string, error) {
+	release, err := GetLatestRelease(d.GitHub, d.Owner, d.Repo)
+	if err != nil {
+		return "", err
+	}
+
+	version, url, err := GetAria2ReleaseDownload(d.GitHub, d.Owner, d.Repo, release)
+	if err != nil {
+		return "", err
+	}
+
+	d.latestVersion = version
+	d.latestUrl = url
+	return version, nil
+}
+
+func (d *Aria2Dependency) Install(version string) error {
+	url := d.latestUrl
+	if version != d.latestVersion {
+		release, err := GetReleaseByTag(d.GitHub, d.Owner, d.Repo, "release-"+version)
+		if err != nil {
+			return fmt.Errorf("Error getting aria2 release %s: %s", version, err)
+		}
+
+		_, url, err = GetAria2ReleaseDownload(d.GitHub, d.Owner, d.Repo, release)
+		if err != nil {
+			return err
+		}
+	}
+
+	err := resetDependencyDir(d.Dir)
+	if err != nil {
+		return fmt.Errorf("Error creating aria2 directory: %s", err)
+	}
+
+	return DownloadAria2(version, url, d.Dir)
+}
+
+// Runs aria2c --version and parses the version number out of it
+func GetAria2Version(binary string) (string, error) {
+	out, err := exec.Command(binary, "--version").Output()
+	if err != nil {
+		return "", err
+	}
+
+	match := aria2VersionRegex.FindStringSubmatch(string(out))
+	if match == nil {
+		return "", fmt.Errorf("Could not find the aria2 version in the output of %s --version", binary)
+	}
+
+	return match[1], nil
+}
+
+// Returns the version of an aria2 release and the download URL of the build for this platform
+func GetAria2ReleaseDownload(gh *github.Client, owner, repo string, release *github.RepositoryRelease) (string, string, error) {
+	version := strings.TrimPrefix(release.GetTagName(), "release-")
+
+	// aria2 only publishes prebuilt binaries for windows
+	if runtime.GOOS != "windows" {
+		return version, "", nil
+	}
+
+	build := "win-64bit"
+	if runtime.GOARCH == "386" {
+		build = "win-32bit"
+	}
+
+	assets, err := GetReleaseAssets(gh, owner, repo, release.GetID())
+	if err != nil {
+		return "", "", err
+	}
+
+	for _, asset := range assets {
+		if strings.Contains(asset.GetName(), build) && strings.HasSuffix(asset.GetName(), ".zip") {
+			return version, asset.GetBrowserDownloadURL(), nil
+		}
+	}
+
+	return "", "", fmt.Errorf("No %s build found in aria2 release %s", build, release.GetTagName())
+}
+
+func DownloadAria2(version, url, dir string) error {
+	var err error
+
+	if url == "" {
+		return fmt.Errorf("There are no aria2 builds for %s, please install aria2 via your systems package manager and re-run the script", runtime.GOOS)
+	}
+
+	archivePath := filepath.Join(dir, "aria2.zip")
+
+	// Download aria2 Archive
+	Debugf("Downloading aria2 from: %s", url)
+	err = DownloadFile(url, archivePath)
+	if err != nil {
+		return fmt.Errorf("Error downloading aria2: %s", err)
+	}
+
+	Debug("Writing aria2 Version file...")
+	err = WriteVersionFile(dir, version)
+	if err != nil {
+		return fmt.Errorf("Error writing aria2 version file: %s", err)
+	}
+
+	// Extract the aria2 Archive, the root directory is named after the archive
+	Debugf("Unzipping aria2 to %s...", dir)
+	rootDir := strings.TrimSuffix(filepath.Base(url), ".zip") + "/"
+	err = ExtractArchive(archivePath, dir, ExtractOptions{StripPrefix: rootDir, Filters: []string{"aria2c"}, Flatten: true})
+	if err != nil {
+		return fmt.Errorf("Error unzipping aria2: %s", err)
+	}
+
+	return os.Remove(archivePath)
+}
@@ -0,0 +1,67 @@
+package main
+
+import (
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"runtime"
+	"strings"
+	"testing"
+)
+
+func newAria2GitHubServer(t *testing.T) (*httptest.Server, *[]string) {
+	t.Helper()
+
+	requested := []string{}
+	mux := http.NewServeMux()
+	mux.HandleFunc("/repos/aria2/aria2/releases/latest", func(w http.ResponseWriter, r *http.Request) {
+		fmt.Fprint(w, `{"id": 2, "tag_name": "release-1.37.0"}`)
+	})
+	mux.HandleFunc("/repos/aria2/aria2/releases/tags/", func(w http.ResponseWriter, r *http.Request) {
+		requested = append(requested, strings.TrimPrefix(r.URL.Path, "/repos/aria2/aria2/releases/tags/"))
+		fmt.Fprint(w, `{"id": 1, "tag_name": "release-1.36.0"}`)
+	})
+	mux.HandleFunc("/repos/aria2/aria2/releases/", func(w http.ResponseWriter, r *http.Request) {
+		fmt.Fprint(w, `[{"name": "aria2-1.37.0-win-64bit-build1.zip", "browser_download_url": "https://example.com/aria2-1.37.0-win-64bit-build1.zip"}]`)
+	})
+	return httptest.NewServer(mux), &requested
+}
+
+func TestAria2DependencyLatestVersion(t *testing.T) {
+	server, _ := newAria2GitHubServer(t)
+	defer server.Close()
+
+	d := NewAria2Dependency()
+	d.Dir = t.TempDir()
+	d.GitHub = newTestGitHubClient(t, server)
+
+	version, err := d.LatestVersion()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if version != "1.37.0" {
+		t.Errorf("got version %q, expected the release- prefix to be stripped", version)
+	}
+}
+
+func TestAria2DependencyInstallPinned(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("aria2 publishes builds for windows")
+	}
+
+	server, requested := newAria2GitHubServer(t)
+	defer server.Close()
+
+	d := NewAria2Dependency()
+	d.Dir = t.TempDir()
+	d.GitHub = newTestGitHubClient(t, server)
+
+	// there are no builds for this platform, but the pinned release is still looked up by its tag
+	err := d.Install("1.36.0")
+	if err == nil || !strings.Contains(err.Error(), "There are no aria2 builds for "+runtime.GOOS) {
+		t.Fatalf("expected the missing build to be an error, got %v", err)
+	}
+	if len(*requested) != 1 || (*requested)[0] != "release-1.36.0" {
+		t.Errorf("got tags %v, expected release-1.36.0", *requested)
+	}
+}
@@ -0,0 +1,268 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"net"
+	"net/http"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strconv"
+	"sync/atomic"
+	"time"
+
+	"github.com/schollz/progressbar/v3"
+)
+
+// How often the status of a running download is polled
+const ARIA2_POLL_INTERVAL = 500 * time.Millisecond
+
+// Download backend that queues files in an aria2c process over JSON-RPC
+type Aria2Backend struct {
+	RPCURL string
+	Secret string
+
+	cmd    *exec.Cmd
+	client *http.Client
+	nextID int64
+}
+
+type aria2Request struct {
+	JSONRPC string        `json:"jsonrpc"`
+	ID      string        `json:"id"`
+	Method  string        `json:"method"`
+	Params  []interface{} `json:"params"`
+}
+
+type aria2Response struct {
+	ID     string          `json:"id"`
+	Result json.RawMessage `json:"result"`
+	Error  *struct {
+		Code    int    `json:"code"`
+		Message string `json:"message"`
+	} `json:"error"`
+}
+
+type aria2Status struct {
+	GID             string `json:"gid"`
+	Status          string `json:"status"`
+	TotalLength     string `json:"totalLength"`
+	CompletedLength string `json:"completedLength"`
+	ErrorCode       string `json:"errorCode"`
+	ErrorMessage    string `json:"errorMessage"`
+}
+
+// Connects to an aria2 instance that is already running with RPC enabled
+func NewAria2Backend(rpcURL, secret string) *Aria2Backend {
+	return &Aria2Backend{
+		RPCURL: rpcURL,
+		Secret: secret,
+		// RPC calls are local, they don't go through the retrying client
+		client: &http.Client{Timeout: 30 * time.Second},
+	}
+}
+
+// Starts aria2c with RPC enabled on a free local port and waits until it answers
+func StartAria2(binary string, connections int) (*Aria2Backend, error) {
+	port, err := freePort()
+	if err != nil {
+		return nil, err
+	}
+
+	secretBytes := make([]byte, 16)
+	_, err = rand.Read(secretBytes)
+	if err != nil {
+		return nil, err
+	}
+	secret := hex.EncodeToString(secretBytes)
+
+	args := []string{
+		"--enable-rpc",
+		"--rpc-listen-all=false",
+		"--rpc-listen-port=" + strconv.Itoa(port),
+		"--rpc-secret=" + secret,
+		"--split=" + strconv.Itoa(connections),
+		"--max-connection-per-server=" + strconv.Itoa(connections),
+		"--min-split-size=1M",
+		"--continue=true",
+		"--auto-file-renaming=false",
+		"--allow-overwrite=true",
+		"--max-tries=" + strconv.Itoa(httpRetryTransport.MaxAttempts),
+		"--quiet=true",
+	}
+
+	Debugf("Starting %s on port %d", binary, port)
+	cmd := exec.Command(binary, args...)
+	err = cmd.Start()
+	if err != nil {
+		return nil, fmt.Errorf("Error starting aria2: %s", err)
+	}
+
+	backend := NewAria2Backend(fmt.Sprintf("http://127.0.0.1:%d/jsonrpc", port), secret)
+	backend.cmd = cmd
+
+	// wait for the RPC server to come up
+	deadline := time.Now().Add(10 * time.Second)
+	for {
+		var version struct {
+			Version string `json:"version"`
+		}
+		err = backend.call(context.Background(), "aria2.getVersion", nil, &version)
+		if err == nil {
+			Debugf("aria2 %s is ready", version.Version)
+			return backend, nil
+		}
+		if time.Now().After(deadline) {
+			cmd.Process.Kill()
+			cmd.Wait()
+			return nil, fmt.Errorf("aria2 RPC did not start: %s", err)
+		}
+		time.Sleep(100 * time.Millisecond)
+	}
+}
+
+func freePort() (int, error) {
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		return 0, err
+	}
+	defer listener.Close()
+
+	return listener.Addr().(*net.TCPAddr).Port, nil
+}
+
+// Sends a JSON-RPC call, the secret token is added in front of the params
+func (a *Aria2Backend) call(ctx context.Context, method string, params []interface{}, result interface{}) error {
+	if a.Secret != "" {
+		params = append([]interface{}{"token:" + a.Secret}, params...)
+	}
+	if params == nil {
+		params = []interface{}{}
+	}
+
+	body, err := json.Marshal(aria2Request{
+		JSONRPC: "2.0",
+		ID:      strconv.FormatInt(atomic.AddInt64(&a.nextID, 1), 10),
+		Method:  method,
+		Params:  params,
+	})
+	if err != nil {
+		return err
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, a.RPCURL, bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+
+	resp, err := a.client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	rpcResp := aria2Response{}
+	err = json.NewDecoder(resp.Body).Decode(&rpcResp)
+	if err != nil {
+		return fmt.Errorf("invalid aria2 response (%s): %s", resp.Status, err)
+	}
+
+	if rpcResp.Error != nil {
+		return fmt.Errorf("aria2 %s failed: %s (code %d)", method, rpcResp.Error.Message, rpcResp.Error.Code)
+	}
+
+	if result != nil {
+		return json.Unmarshal(rpcResp.Result, result)
+	}
+	return nil
+}
+
+// Queues a file in aria2 and waits for it to finish, it is downloaded to a .part file first like the native backend does
+func (a *Aria2Backend) Download(ctx context.Context, url, dest string, newBar ProgressFactory) error {
+	partPath := dest + ".part"
+	dir, err := filepath.Abs(filepath.Dir(partPath))
+	if err != nil {
+		return err
+	}
+	options := map[string]string{
+		"dir": dir,
+		"out": filepath.Base(partPath),
+	}
+
+	var gid string
+	err = a.call(ctx, "aria2.addUri", []interface{}{[]string{url}, options}, &gid)
+	if err != nil {
+		return err
+	}
+
+	var bar *progressbar.ProgressBar
+	ticker := time.NewTicker(ARIA2_POLL_INTERVAL)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			// the .part and .aria2 control files stay around so the download can be resumed
+			a.call(context.Background(), "aria2.forceRemove", []interface{}{gid}, nil)
+			return ctx.Err()
+		case <-ticker.C:
+		}
+
+		status := aria2Status{}
+		err = a.call(ctx, "aria2.tellStatus", []interface{}{gid, []string{"gid", "status", "totalLength", "completedLength", "errorCode", "errorMessage"}}, &status)
+		if err != nil {
+			if ctx.Err() != nil {
+				continue
+			}
+			return err
+		}
+
+		total, _ := strconv.ParseInt(status.TotalLength, 10, 64)
+		completed, _ := strconv.ParseInt(status.CompletedLength, 10, 64)
+		if bar == nil && newBar != nil && total > 0 {
+			bar = newBar(total)
+		}
+		if bar != nil {
+			bar.Set64(completed)
+		}
+
+		switch status.Status {
+		case "complete":
+			a.call(ctx, "aria2.removeDownloadResult", []interface{}{gid}, nil)
+			return os.Rename(partPath, dest)
+		case "error", "removed":
+			a.call(ctx, "aria2.removeDownloadResult", []interface{}{gid}, nil)
+			return fmt.Errorf("aria2 download failed: %s (code %s)", status.ErrorMessage, status.ErrorCode)
+		}
+	}
+}
+
+// Shuts aria2 down if we started it
+func (a *Aria2Backend) Close() error {
+	if a.cmd == nil {
+		return nil
+	}
+
+	err := a.call(context.Background(), "aria2.shutdown", nil, nil)
+	if err != nil {
+		Debugf("aria2 shutdown failed, killing it: %s", err)
+		a.cmd.Process.Kill()
+	}
+
+	done := make(chan error, 1)
+	go func() { done <- a.cmd.Wait() }()
+	select {
+	case <-done:
+	case <-time.After(5 * time.Second):
+		a.cmd.Process.Kill()
+		<-done
+	}
+
+	return nil
+}
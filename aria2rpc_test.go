@@ -0,0 +1,207 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"testing"
+)
+
+// A fake aria2 JSON-RPC server, addUri writes the .part file right away and tellStatus reports
+// the download as active once before it completes or fails
+type fakeAria2 struct {
+	t      *testing.T
+	secret string
+
+	// called whenever the status of a download is polled
+	onPoll func()
+
+	mu        sync.Mutex
+	downloads map[string]*fakeAria2Download
+	methods   []string
+}
+
+type fakeAria2Download struct {
+	url    string
+	polls  int
+	failed bool
+}
+
+func newFakeAria2(t *testing.T, secret string) (*fakeAria2, *httptest.Server) {
+	fake := &fakeAria2{t: t, secret: secret, downloads: map[string]*fakeAria2Download{}}
+	return fake, httptest.NewServer(fake)
+}
+
+func (f *fakeAria2) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	req := struct {
+		ID     string            `json:"id"`
+		Method string            `json:"method"`
+		Params []json.RawMessage `json:"params"`
+	}{}
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		f.t.Errorf("invalid request: %s", err)
+		return
+	}
+
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.methods = append(f.methods, req.Method)
+
+	reply := func(result interface{}) {
+		json.NewEncoder(w).Encode(map[string]interface{}{"jsonrpc": "2.0", "id": req.ID, "result": result})
+	}
+	fail := func(code int, message string) {
+		json.NewEncoder(w).Encode(map[string]interface{}{"jsonrpc": "2.0", "id": req.ID, "error": map[string]interface{}{"code": code, "message": message}})
+	}
+
+	// every call starts with the secret token
+	var token string
+	if len(req.Params) == 0 || json.Unmarshal(req.Params[0], &token) != nil || token != "token:"+f.secret {
+		fail(1, "Unauthorized")
+		return
+	}
+	params := req.Params[1:]
+
+	switch req.Method {
+	case "aria2.getVersion":
+		reply(map[string]string{"version": "1.36.0"})
+	case "aria2.addUri":
+		var uris []string
+		var options map[string]string
+		json.Unmarshal(params[0], &uris)
+		json.Unmarshal(params[1], &options)
+
+		// aria2 writes to dir/out
+		if !strings.HasSuffix(options["out"], ".part") {
+			f.t.Errorf("expected a .part output, got %q", options["out"])
+		}
+		os.WriteFile(filepath.Join(options["dir"], options["out"]), []byte("content of "+uris[0]), 0644)
+
+		gid := "gid" + string(rune('a'+len(f.downloads)))
+		f.downloads[gid] = &fakeAria2Download{url: uris[0], failed: strings.Contains(uris[0], "fail")}
+		reply(gid)
+	case "aria2.tellStatus":
+		var gid string
+		json.Unmarshal(params[0], &gid)
+		download := f.downloads[gid]
+		download.polls++
+		if f.onPoll != nil {
+			f.onPoll()
+		}
+
+		status := map[string]string{"gid": gid, "status": "active", "totalLength": "100", "completedLength": "40"}
+		switch {
+		case download.polls < 2:
+		case download.failed:
+			status["status"] = "error"
+			status["errorCode"] = "3"
+			status["errorMessage"] = "Resource not found"
+		default:
+			status["status"] = "complete"
+			status["completedLength"] = "100"
+		}
+		reply(status)
+	case "aria2.removeDownloadResult", "aria2.forceRemove", "aria2.shutdown":
+		reply("OK")
+	default:
+		fail(1, "unknown method "+req.Method)
+	}
+}
+
+func (f *fakeAria2) called(method string) bool {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	for _, m := range f.methods {
+		if m == method {
+			return true
+		}
+	}
+	return false
+}
+
+func TestAria2BackendDownload(t *testing.T) {
+	fake, server := newFakeAria2(t, "s3cret")
+	defer server.Close()
+
+	backend := NewAria2Backend(server.URL+"/jsonrpc", "s3cret")
+	dest := filepath.Join(t.TempDir(), "video.mp4")
+	err := backend.Download(context.Background(), "https://example.com/video.mp4", dest, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	data, err := os.ReadFile(dest)
+	if err != nil || string(data) != "content of https://example.com/video.mp4" {
+		t.Errorf("unexpected file contents %q: %v", data, err)
+	}
+	if FileExists(dest + ".part") {
+		t.Error("the .part file should have been renamed")
+	}
+	if !fake.called("aria2.removeDownloadResult") {
+		t.Error("the download result should have been removed")
+	}
+}
+
+func TestAria2BackendDownloadError(t *testing.T) {
+	_, server := newFakeAria2(t, "s3cret")
+	defer server.Close()
+
+	backend := NewAria2Backend(server.URL+"/jsonrpc", "s3cret")
+	dest := filepath.Join(t.TempDir(), "video.mp4")
+	err := backend.Download(context.Background(), "https://example.com/fail.mp4", dest, nil)
+	if err == nil || !strings.Contains(err.Error(), "Resource not found (code 3)") {
+		t.Fatalf("expected the aria2 error, got %v", err)
+	}
+	if FileExists(dest) {
+		t.Error("a failed download shouldn't be renamed into place")
+	}
+}
+
+func TestAria2BackendSecret(t *testing.T) {
+	_, server := newFakeAria2(t, "s3cret")
+	defer server.Close()
+
+	backend := NewAria2Backend(server.URL+"/jsonrpc", "wrong")
+	err := backend.call(context.Background(), "aria2.getVersion", nil, nil)
+	if err == nil || !strings.Contains(err.Error(), "Unauthorized") {
+		t.Fatalf("expected the wrong secret to be rejected, got %v", err)
+	}
+
+	backend = NewAria2Backend(server.URL+"/jsonrpc", "s3cret")
+	var version struct {
+		Version string `json:"version"`
+	}
+	err = backend.call(context.Background(), "aria2.getVersion", nil, &version)
+	if err != nil || version.Version != "1.36.0" {
+		t.Fatalf("unexpected version %q: %v", version.Version, err)
+	}
+}
+
+func TestAria2BackendCancel(t *testing.T) {
+	fake, server := newFakeAria2(t, "s3cret")
+	defer server.Close()
+
+	// cancel while aria2 is downloading, as if the user interrupted us
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	fake.onPoll = cancel
+
+	backend := NewAria2Backend(server.URL+"/jsonrpc", "s3cret")
+	dest := filepath.Join(t.TempDir(), "video.mp4")
+	err := backend.Download(ctx, "https://example.com/video.mp4", dest, nil)
+	if err != context.Canceled {
+		t.Fatalf("expected the download to be cancelled, got %v", err)
+	}
+	if !fake.called("aria2.forceRemove") {
+		t.Error("a cancelled download should be removed from aria2")
+	}
+	// the partial file stays so aria2 can resume it
+	if FileExists(dest) {
+		t.Error("a cancelled download shouldn't be renamed into place")
+	}
+}
@@ -0,0 +1,389 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"html"
+	"mime"
+	"net/http"
+	"net/url"
+	"os"
+	"path"
+	"path/filepath"
+	"regexp"
+	"strings"
+)
+
+var articleImgSrc = regexp.MustCompile(`(?is)(<img\b[^>]*?\bsrc\s*=\s*)("[^"]*"|'[^']*')`)
+var articleLinkHref = regexp.MustCompile(`(?is)(<a\b[^>]*?\bhref\s*=\s*)("[^"]*"|'[^']*')`)
+
+const articleTemplate = `<!DOCTYPE html>
+<html>
+<head>
+<meta charset="utf-8">
+<title>%s</title>
+<style>
+body { max-width: 50em; margin: 2em auto; padding: 0 1em; font-family: sans-serif; line-height: 1.5; }
+img { max-width: 100%%; }
+pre { overflow-x: auto; padding: 1em; background: #f5f5f5; }
+</style>
+</head>
+<body>
+<h1>%s</h1>
+%s
+</body>
+</html>
+`
+
+// Makes an article body work offline. The images are downloaded into a directory next to htmlPath
+// and relative links are pointed at baseURL.
+func LocalizeArticle(ctx context.Context, body, htmlPath, baseURL string) (string, error) {
+	imageDir := strings.TrimSuffix(htmlPath, filepath.Ext(htmlPath)) + "_files"
+	body, err := downloadArticleImages(ctx, body, imageDir)
+	removeEmptyDir(imageDir)
+	if err != nil {
+		return "", err
+	}
+
+	return rewriteArticleLinks(body, baseURL), nil
+}
+
+// Wraps an article body in a standalone HTML page
+func SaveArticle(title, body, htmlPath string) error {
+	escaped := html.EscapeString(title)
+	return WriteFileAtomic(htmlPath, []byte(fmt.Sprintf(articleTemplate, escaped, escaped, body)))
+}
+
+// Splits a quoted attribute value into its unescaped value and quote character
+func unquoteAttribute(quoted string) (string, string) {
+	return html.UnescapeString(quoted[1 : len(quoted)-1]), quoted[:1]
+}
+
+// Downloads the images of an article and points their src at the local copies, images that fail to download keep their URL
+func downloadArticleImages(ctx context.Context, body, dir string) (string, error) {
+	local := map[string]string{}
+	var failed error
+
+	body = articleImgSrc.ReplaceAllStringFunc(body, func(tag string) string {
+		m := articleImgSrc.FindStringSubmatch(tag)
+		src, quote := unquoteAttribute(m[2])
+		if !strings.HasPrefix(src, "http://") && !strings.HasPrefix(src, "https://") && !strings.HasPrefix(src, "//") {
+			// data URIs are already inline
+			return tag
+		}
+		if strings.HasPrefix(src, "//") {
+			src = "https:" + src
+		}
+
+		name, ok := local[src]
+		if !ok {
+			// keep the error of the image that failed first
+			if failed != nil {
+				return tag
+			}
+			if err := EnsureDirExist(dir); err != nil {
+				failed = fmt.Errorf("Error creating the directory for article image %s: %s", src, err)
+				return tag
+			}
+
+			var err error
+			name, err = downloadArticleImage(ctx, src, dir, len(local)+1)
+			if err != nil {
+				if ctx.Err() != nil {
+					failed = ctx.Err()
+				}
+				Warningf("Failed to download article image %s: %s", src, err)
+				return tag
+			}
+			local[src] = name
+		}
+
+		rel := (&url.URL{Path: path.Join(filepath.Base(dir), name)}).String()
+		return m[1] + quote + html.EscapeString(rel) + quote + tag[len(m[0]):]
+	})
+
+	return body, failed
+}
+
+// Downloads a single image as <number><ext>, the extension comes from the URL or the content type
+func downloadArticleImage(ctx context.Context, src, dir string, number int) (string, error) {
+	data, err := GetBytesContext(ctx, httpClient, src)
+	if err != nil {
+		return "", err
+	}
+
+	ext := ""
+	if u, err := url.Parse(src); err == nil {
+		ext = strings.ToLower(path.Ext(u.Path))
+	}
+	switch ext {
+	case ".png", ".jpg", ".jpeg", ".gif", ".svg", ".webp", ".bmp":
+	default:
+		ext = ".img"
+		if exts, err := mime.ExtensionsByType(http.DetectContentType(data)); err == nil && len(exts) > 0 {
+			ext = exts[0]
+		}
+	}
+
+	name := fmt.Sprintf("%03d%s", number, ext)
+	p := filepath.Join(dir, name)
+	if FileExists(p) {
+		return name, nil
+	}
+	return name, WriteFileAtomic(p, data)
+}
+
+// Resolves relative links against the portal so they still open the right page from a local file
+func rewriteArticleLinks(body, baseURL string) string {
+	base, err := url.Parse(baseURL)
+	if err != nil || baseURL == "" {
+		return body
+	}
+
+	return articleLinkHref.ReplaceAllStringFunc(body, func(tag string) string {
+		m := articleLinkHref.FindStringSubmatch(tag)
+		href, quote := unquoteAttribute(m[2])
+		ref, err := url.Parse(href)
+		if err != nil || ref.IsAbs() || strings.HasPrefix(href, "#") || href == "" {
+			return tag
+		}
+
+		return m[1] + quote + html.EscapeString(base.ResolveReference(ref).String()) + quote + tag[len(m[0]):]
+	})
+}
+
+var htmlToken = regexp.MustCompile(`(?s)<!--.*?-->|<[^>]*>|[^<]+`)
+var htmlTagName = regexp.MustCompile(`^<\s*(/?)\s*([a-zA-Z0-9]+)`)
+var htmlAttribute = regexp.MustCompile(`(?s)([a-zA-Z_:][-a-zA-Z0-9_:.]*)\s*=\s*("[^"]*"|'[^']*'|[^\s"'>]+)`)
+var htmlWhitespace = regexp.MustCompile(`\s+`)
+var markdownBlankLines = regexp.MustCompile(`\n{3,}`)
+
+func htmlAttributes(tag string) map[string]string {
+	attributes := map[string]string{}
+	for _, m := range htmlAttribute.FindAllStringSubmatch(tag, -1) {
+		value := m[2]
+		if strings.HasPrefix(value, `"`) || strings.HasPrefix(value, `'`) {
+			value = value[1 : len(value)-1]
+		}
+		attributes[strings.ToLower(m[1])] = html.UnescapeString(value)
+	}
+	return attributes
+}
+
+type markdownList struct {
+	ordered bool
+	count   int
+}
+
+// Writes markdown while keeping track of blank lines between blocks
+type markdownWriter struct {
+	b strings.Builder
+}
+
+func (w *markdownWriter) String() string {
+	return w.b.String()
+}
+
+func (w *markdownWriter) write(s string) {
+	w.b.WriteString(s)
+}
+
+// Makes sure the next output starts on a new line
+func (w *markdownWriter) newline() {
+	if s := w.b.String(); s != "" && !strings.HasSuffix(s, "\n") {
+		w.b.WriteString("\n")
+	}
+}
+
+// Makes sure the next output starts a new block
+func (w *markdownWriter) block() {
+	s := w.b.String()
+	switch {
+	case s == "", strings.HasSuffix(s, "\n\n"):
+	case strings.HasSuffix(s, "\n"):
+		w.b.WriteString("\n")
+	default:
+		w.b.WriteString("\n\n")
+	}
+}
+
+func (w *markdownWriter) atLineStart() bool {
+	s := w.b.String()
+	return s == "" || strings.HasSuffix(s, "\n")
+}
+
+// Link destinations with spaces or parentheses have to be put in angle brackets
+func markdownDestination(dest string) string {
+	if strings.ContainsAny(dest, " ()<>") {
+		return "<" + strings.NewReplacer("<", "%3C", ">", "%3E").Replace(dest) + ">"
+	}
+	return dest
+}
+
+// Converts an article body to Markdown, tags without a Markdown equivalent are dropped and their text is kept
+func HTMLToMarkdown(body string) string {
+	w := &markdownWriter{}
+	lists := []markdownList{}
+	links := []string{}
+	quotes := []int{}
+	pre := false
+	skip := ""
+
+	for _, token := range htmlToken.FindAllString(body, -1) {
+		if strings.HasPrefix(token, "<!--") {
+			continue
+		}
+
+		m := htmlTagName.FindStringSubmatch(token)
+		if m == nil {
+			if skip != "" {
+				continue
+			}
+			text := html.UnescapeString(token)
+			if !pre {
+				text = htmlWhitespace.ReplaceAllString(text, " ")
+				if w.atLineStart() || strings.HasSuffix(w.String(), " ") {
+					text = strings.TrimLeft(text, " ")
+				}
+			}
+			w.write(text)
+			continue
+		}
+
+		closing := m[1] == "/"
+		name := strings.ToLower(m[2])
+		if skip != "" {
+			if closing && name == skip {
+				skip = ""
+			}
+			continue
+		}
+
+		switch name {
+		case "script", "style":
+			if !closing {
+				skip = name
+			}
+		case "h1", "h2", "h3", "h4", "h5", "h6":
+			w.block()
+			if !closing {
+				w.write(strings.Repeat("#", int(name[1]-'0')) + " ")
+			}
+		case "p", "div", "table", "section":
+			w.block()
+		case "tr":
+			w.newline()
+		case "td", "th":
+			if !closing {
+				w.write(" ")
+			}
+		case "br":
+			w.write("  \n")
+		case "hr":
+			w.block()
+			w.write("---")
+			w.block()
+		case "strong", "b":
+			w.write("**")
+		case "em", "i":
+			w.write("*")
+		case "code":
+			if !pre {
+				w.write("`")
+			}
+		case "pre":
+			if closing {
+				w.newline()
+				w.write("```")
+				w.block()
+				pre = false
+			} else {
+				w.block()
+				w.write("```\n")
+				pre = true
+			}
+		case "a":
+			if closing {
+				if len(links) > 0 {
+					href := links[len(links)-1]
+					links = links[:len(links)-1]
+					if href != "" {
+						w.write("](" + markdownDestination(href) + ")")
+					}
+				}
+			} else {
+				href := htmlAttributes(token)["href"]
+				links = append(links, href)
+				if href != "" {
+					w.write("[")
+				}
+			}
+		case "img":
+			attributes := htmlAttributes(token)
+			if attributes["src"] != "" {
+				w.write(fmt.Sprintf("![%s](%s)", attributes["alt"], markdownDestination(attributes["src"])))
+			}
+		case "ul", "ol":
+			if closing {
+				if len(lists) > 0 {
+					lists = lists[:len(lists)-1]
+				}
+				if len(lists) == 0 {
+					w.block()
+				}
+			} else {
+				if len(lists) == 0 {
+					w.block()
+				}
+				lists = append(lists, markdownList{ordered: name == "ol"})
+			}
+		case "li":
+			if closing || len(lists) == 0 {
+				continue
+			}
+			w.newline()
+			list := &lists[len(lists)-1]
+			list.count++
+			marker := "- "
+			if list.ordered {
+				marker = fmt.Sprintf("%d. ", list.count)
+			}
+			w.write(strings.Repeat("   ", len(lists)-1) + marker)
+		case "blockquote":
+			w.block()
+			if !closing {
+				quotes = append(quotes, w.b.Len())
+				continue
+			}
+			if len(quotes) == 0 {
+				continue
+			}
+
+			// quote everything written since the blockquote started
+			start := quotes[len(quotes)-1]
+			quotes = quotes[:len(quotes)-1]
+			s := w.String()
+			quoted := strings.Split(strings.TrimSpace(s[start:]), "\n")
+			for i, line := range quoted {
+				quoted[i] = strings.TrimRight("> "+line, " ")
+			}
+			w.b.Reset()
+			w.write(s[:start] + strings.Join(quoted, "\n"))
+			w.block()
+		}
+	}
+
+	return strings.TrimSpace(markdownBlankLines.ReplaceAllString(w.String(), "\n\n")) + "\n"
+}
+
+// Writes the markdown version of an article next to its HTML file
+func SaveArticleMarkdown(title, body, path string) error {
+	return WriteFileAtomic(path, []byte("# "+title+"\n\n"+HTMLToMarkdown(body)))
+}
+
+// Removes the image directory of an article if nothing ended up in it
+func removeEmptyDir(dir string) {
+	if entries, err := os.ReadDir(dir); err == nil && len(entries) == 0 {
+		os.Remove(dir)
+	}
+}
@@ -0,0 +1,142 @@
+package main
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestHTMLToMarkdown(t *testing.T) {
+	tests := []struct {
+		name     string
+		html     string
+		expected string
+	}{
+		{
+			"headings and emphasis",
+			`<h2>Intro &amp; setup</h2><p>Some <strong>bold</strong>, <b>more</b> and <em>it</em>   <i>alic</i> text</p>`,
+			"## Intro & setup\n\nSome **bold**, **more** and *it* *alic* text\n",
+		},
+		{
+			"links",
+			`<p>A <a href="https://example.com/a?b=1&amp;c=2">link</a>, <a href="/my file (1).pdf">file</a> and <a name="x">anchor</a></p>`,
+			"A [link](https://example.com/a?b=1&c=2), [file](</my file (1).pdf>) and anchor\n",
+		},
+		{
+			"nested lists",
+			`<ul><li>one</li><li>two<ol><li>a</li><li>b</li></ol></li></ul><p>after</p>`,
+			"- one\n- two\n   1. a\n   2. b\n\nafter\n",
+		},
+		{
+			"code",
+			"<pre><code>if a &lt; b {\n    x()\n}</code></pre><p>use <code>x()</code></p>",
+			"```\nif a < b {\n    x()\n}\n```\n\nuse `x()`\n",
+		},
+		{
+			"blockquotes",
+			`<blockquote><p>quoted</p><p>twice</p></blockquote>`,
+			"> quoted\n>\n> twice\n",
+		},
+		{
+			"images, line breaks and rules",
+			`<p><img src="a_files/001.png" alt="pic"><br>after<hr>end</p>`,
+			"![pic](a_files/001.png)  \nafter\n\n---\n\nend\n",
+		},
+		{
+			"scripts, styles and comments",
+			`<script>alert(1)</script><style>p{}</style><!-- <p>hidden</p> --><div>shown</div>`,
+			"shown\n",
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			if markdown := HTMLToMarkdown(test.html); markdown != test.expected {
+				t.Errorf("got %q, expected %q", markdown, test.expected)
+			}
+		})
+	}
+}
+
+func TestLocalizeArticle(t *testing.T) {
+	png := []byte("\x89PNG\r\n\x1a\n0000")
+	requests := map[string]int{}
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		requests[r.URL.Path]++
+		if r.URL.Path == "/missing.png" {
+			http.NotFound(w, r)
+			return
+		}
+		w.Write(png)
+	}))
+	defer server.Close()
+
+	body := `<p>See <a href="/course/x/learn/">the course</a>, <a href="#top">top</a> and <a href="https://example.com/">example</a></p>` +
+		`<img src="` + server.URL + `/images/pic?x=1&amp;y=2" alt="p">` +
+		`<img src='` + server.URL + `/images/pic?x=1&amp;y=2'>` +
+		`<img alt="photo" src="` + server.URL + `/images/photo.JPG">` +
+		`<img src="` + server.URL + `/missing.png">` +
+		`<img src="data:image/png;base64,AAAA">`
+
+	dir := t.TempDir()
+	localized, err := LocalizeArticle(context.Background(), body, filepath.Join(dir, "01 Article.html"), "https://www.udemy.com/")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	expected := `<p>See <a href="https://www.udemy.com/course/x/learn/">the course</a>, <a href="#top">top</a> and <a href="https://example.com/">example</a></p>` +
+		`<img src="01%20Article_files/001.png" alt="p">` +
+		`<img src='01%20Article_files/001.png'>` +
+		`<img alt="photo" src="01%20Article_files/002.jpg">` +
+		`<img src="` + server.URL + `/missing.png">` +
+		`<img src="data:image/png;base64,AAAA">`
+	if localized != expected {
+		t.Errorf("got\n%s\nexpected\n%s", localized, expected)
+	}
+
+	// the same image is only downloaded once
+	if requests["/images/pic"] != 1 {
+		t.Errorf("the repeated image was requested %d times", requests["/images/pic"])
+	}
+	for _, name := range []string{"001.png", "002.jpg"} {
+		data, err := os.ReadFile(filepath.Join(dir, "01 Article_files", name))
+		if err != nil || string(data) != string(png) {
+			t.Errorf("%s: unexpected contents %q: %v", name, data, err)
+		}
+	}
+}
+
+func TestLocalizeArticleWithoutImages(t *testing.T) {
+	dir := t.TempDir()
+	body := `<p>text <img src="data:image/png;base64,AAAA"></p>`
+	localized, err := LocalizeArticle(context.Background(), body, filepath.Join(dir, "article.html"), "")
+	if err != nil || localized != body {
+		t.Fatalf("got %q: %v", localized, err)
+	}
+	if FileExists(filepath.Join(dir, "article_files")) {
+		t.Error("an empty image directory should be removed")
+	}
+}
+
+func TestLocalizeArticleImageDirError(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte("image"))
+	}))
+	defer server.Close()
+
+	// a file is in the way of the image directory
+	dir := t.TempDir()
+	if err := os.WriteFile(filepath.Join(dir, "article_files"), nil, 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	body := `<img src="` + server.URL + `/first.png"><img src="data:image/png;base64,AAAA"><img src="` + server.URL + `/last.png">`
+	_, err := LocalizeArticle(context.Background(), body, filepath.Join(dir, "article.html"), "")
+	if err == nil || !strings.Contains(err.Error(), server.URL+"/first.png") {
+		t.Fatalf("expected an error for the first image, got %v", err)
+	}
+}
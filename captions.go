@@ -0,0 +1,195 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"fmt"
+	"html"
+	"regexp"
+	"strconv"
+	"strings"
+)
+
+// The -captions option, languages match locales by their language ("en" matches en_US and en_GB) or exactly ("en_US")
+type CaptionSelection struct {
+	All       bool
+	Languages []string
+}
+
+// Parses a comma separated list of languages or "all", an empty string selects nothing
+func ParseCaptionSelection(s string) (CaptionSelection, error) {
+	selection := CaptionSelection{}
+	for _, language := range strings.Split(s, ",") {
+		language = strings.TrimSpace(language)
+		if language == "" {
+			continue
+		}
+		if strings.EqualFold(language, "all") {
+			selection.All = true
+			continue
+		}
+		if strings.ContainsAny(language, " /\\") {
+			return CaptionSelection{}, fmt.Errorf("Invalid caption language %q, use languages like en,es or all", language)
+		}
+		selection.Languages = append(selection.Languages, language)
+	}
+	return selection, nil
+}
+
+func (s CaptionSelection) Enabled() bool {
+	return s.All || len(s.Languages) > 0
+}
+
+func (s CaptionSelection) Matches(locale string) bool {
+	if s.All {
+		return true
+	}
+
+	normalized := strings.ReplaceAll(locale, "-", "_")
+	for _, language := range s.Languages {
+		language = strings.ReplaceAll(language, "-", "_")
+		if strings.EqualFold(language, normalized) || strings.EqualFold(language, strings.SplitN(normalized, "_", 2)[0]) {
+			return true
+		}
+	}
+	return false
+}
+
+// Whether Udemy generated the caption instead of a person
+func IsAutoCaption(caption UdemyCaption) bool {
+	return strings.EqualFold(caption.Source, "auto") || strings.Contains(strings.ToLower(caption.VideoLabel), "[auto]")
+}
+
+// The language part of a caption filename like en-US, or en-US-auto for generated captions
+func CaptionLanguage(caption UdemyCaption) string {
+	language := strings.ReplaceAll(caption.Locale, "_", "-")
+	if language == "" {
+		language = "unknown"
+	}
+	if IsAutoCaption(caption) {
+		language += "-auto"
+	}
+	return SanitizeFilename(language)
+}
+
+var vttTimestamp = regexp.MustCompile(`^(?:(\d+):)?(\d{2}):(\d{2})\.(\d{3})$`)
+
+// Tags like <c.yellow>, <v Speaker>, <b> and the karaoke timestamps <00:00:01.000>
+var vttTag = regexp.MustCompile(`<(/?)([^>\s.]*)[^>]*>`)
+
+// SRT players understand bold, italic and underline, every other tag is removed
+func convertVTTTags(line string) string {
+	return vttTag.ReplaceAllStringFunc(line, func(tag string) string {
+		m := vttTag.FindStringSubmatch(tag)
+		switch m[2] {
+		case "b", "i", "u":
+			// drop classes like <b.loud>
+			return "<" + m[1] + m[2] + ">"
+		}
+		return ""
+	})
+}
+
+// Parses a WebVTT timestamp, the hours are optional
+func parseVTTTimestamp(s string) (int64, error) {
+	m := vttTimestamp.FindStringSubmatch(s)
+	if m == nil {
+		return 0, fmt.Errorf("invalid timestamp %q", s)
+	}
+
+	hours := int64(0)
+	if m[1] != "" {
+		hours, _ = strconv.ParseInt(m[1], 10, 64)
+	}
+	minutes, _ := strconv.ParseInt(m[2], 10, 64)
+	seconds, _ := strconv.ParseInt(m[3], 10, 64)
+	millis, _ := strconv.ParseInt(m[4], 10, 64)
+
+	return ((hours*60+minutes)*60+seconds)*1000 + millis, nil
+}
+
+func formatSRTTimestamp(ms int64) string {
+	return fmt.Sprintf("%02d:%02d:%02d,%03d", ms/3600000, ms/60000%60, ms/1000%60, ms%1000)
+}
+
+// Converts WebVTT captions to SRT. Tags other than <b>, <i> and <u> are removed, cue settings are dropped and multi-line cues stay multi-line.
+func ConvertVTTToSRT(data []byte) ([]byte, error) {
+	data = bytes.TrimPrefix(data, []byte("\xef\xbb\xbf"))
+	data = bytes.ReplaceAll(data, []byte("\r\n"), []byte("\n"))
+
+	// split into blocks separated by blank lines
+	blocks := [][]string{}
+	block := []string{}
+	scanner := bufio.NewScanner(bytes.NewReader(data))
+	scanner.Buffer(make([]byte, 0, 64*1024), 1024*1024)
+	for scanner.Scan() {
+		line := strings.TrimRight(scanner.Text(), " \t\r")
+		if line == "" {
+			if len(block) > 0 {
+				blocks = append(blocks, block)
+				block = []string{}
+			}
+			continue
+		}
+		block = append(block, line)
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, err
+	}
+	if len(block) > 0 {
+		blocks = append(blocks, block)
+	}
+
+	if len(blocks) == 0 || !strings.HasPrefix(blocks[0][0], "WEBVTT") {
+		return nil, fmt.Errorf("not a WebVTT file")
+	}
+
+	out := bytes.Buffer{}
+	number := 0
+	for _, block := range blocks[1:] {
+		if header := strings.Fields(block[0]); len(header) > 0 && (header[0] == "NOTE" || header[0] == "STYLE" || header[0] == "REGION") {
+			continue
+		}
+
+		// the timing line is the first or, after a cue identifier, the second line
+		timing := -1
+		for i := 0; i < len(block) && i < 2; i++ {
+			if strings.Contains(block[i], "-->") {
+				timing = i
+				break
+			}
+		}
+		if timing < 0 {
+			continue
+		}
+
+		fields := strings.Fields(strings.Replace(block[timing], "-->", " --> ", 1))
+		if len(fields) < 3 || fields[1] != "-->" {
+			return nil, fmt.Errorf("invalid cue timing %q", block[timing])
+		}
+		start, err := parseVTTTimestamp(fields[0])
+		if err != nil {
+			return nil, err
+		}
+		end, err := parseVTTTimestamp(fields[2])
+		if err != nil {
+			return nil, err
+		}
+
+		lines := []string{}
+		for _, line := range block[timing+1:] {
+			line = strings.TrimSpace(html.UnescapeString(convertVTTTags(line)))
+			if line != "" {
+				lines = append(lines, line)
+			}
+		}
+		if len(lines) == 0 {
+			continue
+		}
+
+		number++
+		fmt.Fprintf(&out, "%d\n%s --> %s\n%s\n\n", number, formatSRTTimestamp(start), formatSRTTimestamp(end), strings.Join(lines, "\n"))
+	}
+
+	return out.Bytes(), nil
+}
@@ -0,0 +1,131 @@
+package main
+
+import (
+	"testing"
+)
+
+func TestConvertVTTToSRT(t *testing.T) {
+	tests := []struct {
+		name     string
+		vtt      string
+		expected string
+	}{
+		{
+			"timestamps without hours",
+			"WEBVTT\n\n00:01.000 --> 00:04.500\nHello\n",
+			"1\n00:00:01,000 --> 00:00:04,500\nHello\n\n",
+		},
+		{
+			"timestamps with hours",
+			"WEBVTT\n\n01:02:03.004 --> 101:00:00.000\nHello\n",
+			"1\n01:02:03,004 --> 101:00:00,000\nHello\n\n",
+		},
+		{
+			"cue settings",
+			"WEBVTT\n\n00:01.000 --> 00:02.000 align:start position:10% line:0\nHello\n",
+			"1\n00:00:01,000 --> 00:00:02,000\nHello\n\n",
+		},
+		{
+			"cue identifiers",
+			"WEBVTT\n\nintro\n00:01.000 --> 00:02.000\nHello\n\n7\n00:03.000 --> 00:04.000\nagain\n",
+			"1\n00:00:01,000 --> 00:00:02,000\nHello\n\n2\n00:00:03,000 --> 00:00:04,000\nagain\n\n",
+		},
+		{
+			"multi-line cues",
+			"WEBVTT\n\n00:01.000 --> 00:02.000\nfirst line\n  second line  \n",
+			"1\n00:00:01,000 --> 00:00:02,000\nfirst line\nsecond line\n\n",
+		},
+		{
+			"NOTE, STYLE and REGION blocks",
+			"WEBVTT - title\n\nSTYLE\n::cue { color: red }\n\nNOTE a comment\n00:00.000 --> 00:09.000\n\nREGION\nid:fred\n\n00:01.000 --> 00:02.000\nHello\n",
+			"1\n00:00:01,000 --> 00:00:02,000\nHello\n\n",
+		},
+		{
+			"tags",
+			"WEBVTT\n\n00:01.000 --> 00:02.000\n<v Roger>Hello <c.yellow>there</c> &amp; <b>you</b></v>\n<i>second</i> <00:00:01.500><u>line</u> <b.loud>!</b>\n",
+			"1\n00:00:01,000 --> 00:00:02,000\nHello there & <b>you</b>\n<i>second</i> <u>line</u> <b>!</b>\n\n",
+		},
+		{
+			"cues without text",
+			"WEBVTT\n\n00:01.000 --> 00:02.000\n<c> </c>\n\n00:03.000 --> 00:04.000\nHello\n",
+			"1\n00:00:03,000 --> 00:00:04,000\nHello\n\n",
+		},
+		{
+			"byte order mark and CRLF",
+			"\xef\xbb\xbfWEBVTT\r\n\r\n00:01.000 --> 00:02.000\r\nHello\r\n",
+			"1\n00:00:01,000 --> 00:00:02,000\nHello\n\n",
+		},
+		{
+			"no cues",
+			"WEBVTT\n",
+			"",
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			srt, err := ConvertVTTToSRT([]byte(test.vtt))
+			if err != nil {
+				t.Fatal(err)
+			}
+			if string(srt) != test.expected {
+				t.Errorf("got %q, expected %q", srt, test.expected)
+			}
+		})
+	}
+}
+
+func TestConvertVTTToSRTErrors(t *testing.T) {
+	tests := []string{
+		"",
+		"1\n00:00:01,000 --> 00:00:02,000\nalready SRT\n",
+		"WEBVTT\n\n00:01 --> 00:02.000\nHello\n",
+		"WEBVTT\n\n00:01.000 -> 00:02.000\n-->\n",
+	}
+
+	for _, vtt := range tests {
+		if srt, err := ConvertVTTToSRT([]byte(vtt)); err == nil {
+			t.Errorf("expected %q to be rejected, got %q", vtt, srt)
+		}
+	}
+}
+
+func TestCaptionSelection(t *testing.T) {
+	selection, err := ParseCaptionSelection(" en, pt-BR ,")
+	if err != nil {
+		t.Fatal(err)
+	}
+	for locale, expected := range map[string]bool{"en_US": true, "en_GB": true, "en": true, "pt_BR": true, "pt-BR": true, "pt_PT": false, "es_ES": false} {
+		if selection.Matches(locale) != expected {
+			t.Errorf("%s: expected %v", locale, expected)
+		}
+	}
+
+	if selection, _ := ParseCaptionSelection("ALL"); !selection.Enabled() || !selection.Matches("ja_JP") {
+		t.Error("all should match every locale")
+	}
+	if selection, _ := ParseCaptionSelection(""); selection.Enabled() {
+		t.Error("an empty selection shouldn't be enabled")
+	}
+	if _, err := ParseCaptionSelection("en,../es"); err == nil {
+		t.Error("expected a language with a path separator to be rejected")
+	}
+}
+
+func TestCaptionLanguage(t *testing.T) {
+	tests := []struct {
+		caption  UdemyCaption
+		expected string
+	}{
+		{UdemyCaption{Locale: "en_US", Source: "manual"}, "en-US"},
+		{UdemyCaption{Locale: "en_US", Source: "auto"}, "en-US-auto"},
+		{UdemyCaption{Locale: "es_ES", VideoLabel: "Spanish [Auto]"}, "es-ES-auto"},
+		{UdemyCaption{}, "unknown"},
+	}
+
+	for _, test := range tests {
+		if language := CaptionLanguage(test.caption); language != test.expected {
+			t.Errorf("%+v: got %q, expected %q", test.caption, language, test.expected)
+		}
+	}
+}
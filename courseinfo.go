@@ -0,0 +1,68 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"time"
+)
+
+// Bump this whenever the layout of the saved course information changes in an incompatible way
+const COURSE_INFO_FORMAT_VERSION = 1
+
+// Document written by -save-info and read by -load-info
+type CourseInfoFile struct {
+	FormatVersion int       `json:"format_version"`
+	ToolVersion   string    `json:"tool_version"`
+	SavedAt       time.Time `json:"saved_at"`
+	Course        *Course   `json:"course"`
+}
+
+// Writes the course to a JSON file, the file is written next to the destination first so a failed write never leaves a truncated file behind
+func SaveCourseInfo(path string, course *Course) error {
+	doc := CourseInfoFile{
+		FormatVersion: COURSE_INFO_FORMAT_VERSION,
+		ToolVersion:   version,
+		SavedAt:       time.Now().UTC(),
+		Course:        course,
+	}
+
+	data, err := json.MarshalIndent(doc, "", "  ")
+	if err != nil {
+		return err
+	}
+
+	dir := filepath.Dir(path)
+	err = EnsureDirExist(dir)
+	if err != nil {
+		return err
+	}
+
+	return WriteFileAtomic(path, data)
+}
+
+// Reads a course from a file written by SaveCourseInfo
+func LoadCourseInfo(path string) (*Course, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+
+	doc := CourseInfoFile{}
+	err = json.Unmarshal(data, &doc)
+	if err != nil {
+		return nil, fmt.Errorf("Error parsing course information: %s", err)
+	}
+
+	if doc.FormatVersion == 0 || doc.Course == nil {
+		return nil, fmt.Errorf("%s does not look like a course information file", path)
+	}
+
+	if doc.FormatVersion > COURSE_INFO_FORMAT_VERSION {
+		return nil, fmt.Errorf("%s was saved with format version %d by %s, this version only supports up to %d", path, doc.FormatVersion, doc.ToolVersion, COURSE_INFO_FORMAT_VERSION)
+	}
+
+	Debugf("Loaded course information saved by %s at %s", doc.ToolVersion, doc.SavedAt.Format(time.RFC3339))
+	return doc.Course, nil
+}
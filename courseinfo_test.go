@@ -0,0 +1,98 @@
+package main
+
+import (
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestCourseInfoRoundTrip(t *testing.T) {
+	course := buildFixtureCourse(t)
+	course.Chapters[0].Lectures[0].Asset.Video.SelectedQuality = 720
+
+	// the directory doesn't exist yet
+	dir := t.TempDir()
+	path := filepath.Join(dir, "info", "course.json")
+	if err := SaveCourseInfo(path, course); err != nil {
+		t.Fatal(err)
+	}
+
+	loaded, err := LoadCourseInfo(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(loaded, course) {
+		t.Errorf("the loaded course differs from the saved one:\n%+v\n%+v", loaded, course)
+	}
+
+	data, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	doc := CourseInfoFile{}
+	if err := json.Unmarshal(data, &doc); err != nil {
+		t.Fatal(err)
+	}
+	if doc.FormatVersion != COURSE_INFO_FORMAT_VERSION || doc.ToolVersion != version || doc.SavedAt.IsZero() {
+		t.Errorf("unexpected header: %d %q %s", doc.FormatVersion, doc.ToolVersion, doc.SavedAt)
+	}
+
+	// nothing but the file itself is left behind
+	entries, _ := os.ReadDir(filepath.Dir(path))
+	if len(entries) != 1 {
+		t.Errorf("expected only the course file, got %d entries", len(entries))
+	}
+}
+
+func TestLoadCourseInfoErrors(t *testing.T) {
+	tests := []struct {
+		name     string
+		content  string
+		expected string
+	}{
+		{"newer format", `{"format_version":2,"tool_version":"v9.0.0","course":{"id":1}}`, "was saved with format version 2 by v9.0.0, this version only supports up to 1"},
+		{"no format version", `{"course":{"id":1}}`, "does not look like a course information file"},
+		{"no course", `{"format_version":1}`, "does not look like a course information file"},
+		{"course list", `[{"id":1}]`, "Error parsing course information"},
+		{"truncated", `{"format_version":1,"course":{`, "Error parsing course information"},
+	}
+
+	dir := t.TempDir()
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			path := filepath.Join(dir, test.name+".json")
+			if err := os.WriteFile(path, []byte(test.content), 0644); err != nil {
+				t.Fatal(err)
+			}
+
+			_, err := LoadCourseInfo(path)
+			if err == nil || !strings.Contains(err.Error(), test.expected) {
+				t.Errorf("expected an error containing %q, got %v", test.expected, err)
+			}
+		})
+	}
+
+	if _, err := LoadCourseInfo(filepath.Join(dir, "missing.json")); !os.IsNotExist(err) {
+		t.Errorf("expected a missing file error, got %v", err)
+	}
+}
+
+func TestLoadCourseInfoOlderFormat(t *testing.T) {
+	// format versions up to the current one are still read
+	path := filepath.Join(t.TempDir(), "course.json")
+	content := `{"format_version":1,"tool_version":"v1.0.0","saved_at":"2024-01-02T03:04:05Z","course":{"id":5,"title":"Old","chapters":[{"title":"One","lectures":[{"id":9,"title":"Lecture"}]}]}}`
+	if err := os.WriteFile(path, []byte(content), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	course, err := LoadCourseInfo(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if course.ID != 5 || course.LectureCount() != 1 || course.Chapters[0].Lectures[0].Title != "Lecture" {
+		t.Errorf("unexpected course: %+v", course)
+	}
+}
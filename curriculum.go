@@ -0,0 +1,221 @@
+package main
+
+import (
+	"fmt"
+)
+
+type AssetType string
+
+const (
+	AssetTypeVideo        AssetType = "Video"
+	AssetTypeArticle      AssetType = "Article"
+	AssetTypeFile         AssetType = "File"
+	AssetTypeEBook        AssetType = "E-Book"
+	AssetTypeExternalLink AssetType = "ExternalLink"
+	AssetTypePresentation AssetType = "Presentation"
+)
+
+// Fully parsed course, chapters and lectures are kept in curriculum order
+type Course struct {
+	ID         int        `json:"id"`
+	Title      string     `json:"title"`
+	Slug       string     `json:"slug"`
+	PortalName string     `json:"portal_name"`
+	Chapters   []*Chapter `json:"chapters"`
+}
+
+type Chapter struct {
+	ID       int        `json:"id"`
+	Index    int        `json:"object_index"`
+	Title    string     `json:"title"`
+	Lectures []*Lecture `json:"lectures"`
+}
+
+type Lecture struct {
+	ID                  int      `json:"id"`
+	Index               int      `json:"object_index"`
+	Title               string   `json:"title"`
+	Asset               *Asset   `json:"asset"`
+	SupplementaryAssets []*Asset `json:"supplementary_assets"`
+}
+
+// An asset of a lecture, only the payload matching Type is set
+type Asset struct {
+	ID             int       `json:"id"`
+	Type           AssetType `json:"asset_type"`
+	Title          string    `json:"title"`
+	Filename       string    `json:"filename"`
+	TimeEstimation int       `json:"time_estimation"`
+
+	Video        *VideoAsset        `json:"video,omitempty"`
+	Article      *ArticleAsset      `json:"article,omitempty"`
+	File         *FileAsset         `json:"file,omitempty"`
+	ExternalLink *ExternalLinkAsset `json:"external_link,omitempty"`
+	Presentation *PresentationAsset `json:"presentation,omitempty"`
+}
+
+type VideoAsset struct {
+	DownloadURLs      []UdemyDownloadURL `json:"download_urls"`
+	StreamURLs        []UdemyDownloadURL `json:"stream_urls"`
+	MediaSources      []UdemyMediaSource `json:"media_sources"`
+	Captions          []UdemyCaption     `json:"captions"`
+	MediaLicenseToken string             `json:"media_license_token,omitempty"`
+	CourseIsDRMed     bool               `json:"course_is_drmed"`
+	// SelectedQuality is the height that was downloaded, 0 until the video is downloaded
+	SelectedQuality int `json:"selected_quality,omitempty"`
+}
+
+type ArticleAsset struct {
+	Body string `json:"body"`
+}
+
+// Used for both File and E-Book assets
+type FileAsset struct {
+	DownloadURLs []UdemyDownloadURL `json:"download_urls"`
+}
+
+type ExternalLinkAsset struct {
+	URL string `json:"url"`
+}
+
+type PresentationAsset struct {
+	SlideURLs    []string           `json:"slide_urls"`
+	DownloadURLs []UdemyDownloadURL `json:"download_urls"`
+}
+
+// Builds the course tree from the course info and the flat curriculum list returned by COURSE_URL
+func BuildCourse(info *UdemyCourse, portalName string, items []UdemyCurriculumItem) (*Course, error) {
+	course := &Course{
+		ID:         info.ID,
+		Title:      info.Title,
+		Slug:       info.PublishedTitle,
+		PortalName: portalName,
+		Chapters:   []*Chapter{},
+	}
+
+	var chapter *Chapter
+	for _, item := range items {
+		switch item.Class {
+		case "chapter":
+			chapter = &Chapter{
+				ID:       item.ID,
+				Index:    item.ObjectIndex,
+				Title:    item.Title,
+				Lectures: []*Lecture{},
+			}
+			course.Chapters = append(course.Chapters, chapter)
+		case "lecture":
+			// some courses have lectures before the first chapter
+			if chapter == nil {
+				chapter = &Chapter{Index: 0, Title: course.Title, Lectures: []*Lecture{}}
+				course.Chapters = append(course.Chapters, chapter)
+			}
+
+			lecture, err := ParseLecture(item)
+			if err != nil {
+				return nil, err
+			}
+			chapter.Lectures = append(chapter.Lectures, lecture)
+		default:
+			// quizzes, practice tests and coding exercises have nothing to download
+			Debugf("Skipping curriculum item %d (%s): %s", item.ID, item.Class, item.Title)
+		}
+	}
+
+	return course, nil
+}
+
+func ParseLecture(item UdemyCurriculumItem) (*Lecture, error) {
+	lecture := &Lecture{
+		ID:                  item.ID,
+		Index:               item.ObjectIndex,
+		Title:               item.Title,
+		SupplementaryAssets: []*Asset{},
+	}
+
+	if item.Asset != nil {
+		asset, err := ParseAsset(*item.Asset)
+		if err != nil {
+			return nil, fmt.Errorf("Error parsing asset of lecture %d: %s", item.ID, err)
+		}
+		lecture.Asset = asset
+	}
+
+	for _, raw := range item.SupplementaryAssets {
+		asset, err := ParseAsset(raw)
+		if err != nil {
+			return nil, fmt.Errorf("Error parsing supplementary asset of lecture %d: %s", item.ID, err)
+		}
+		lecture.SupplementaryAssets = append(lecture.SupplementaryAssets, asset)
+	}
+
+	return lecture, nil
+}
+
+func ParseAsset(raw UdemyAsset) (*Asset, error) {
+	if raw.AssetType == "" {
+		return nil, fmt.Errorf("asset %d has no asset_type", raw.ID)
+	}
+
+	asset := &Asset{
+		ID:             raw.ID,
+		Type:           AssetType(raw.AssetType),
+		Title:          raw.Title,
+		Filename:       raw.Filename,
+		TimeEstimation: raw.TimeEstimation,
+	}
+
+	switch asset.Type {
+	case AssetTypeVideo:
+		asset.Video = &VideoAsset{
+			DownloadURLs:      raw.DownloadURLs[raw.AssetType],
+			StreamURLs:        raw.StreamURLs[raw.AssetType],
+			MediaSources:      raw.MediaSources,
+			Captions:          raw.Captions,
+			MediaLicenseToken: raw.MediaLicenseToken,
+			CourseIsDRMed:     raw.CourseIsDRMed,
+		}
+	case AssetTypeArticle:
+		asset.Article = &ArticleAsset{Body: raw.Body}
+	case AssetTypeFile, AssetTypeEBook:
+		asset.File = &FileAsset{DownloadURLs: raw.DownloadURLs[raw.AssetType]}
+	case AssetTypeExternalLink:
+		asset.ExternalLink = &ExternalLinkAsset{URL: raw.ExternalURL}
+	case AssetTypePresentation:
+		asset.Presentation = &PresentationAsset{
+			SlideURLs:    raw.SlideURLs,
+			DownloadURLs: raw.DownloadURLs[raw.AssetType],
+		}
+	default:
+		Debugf("Unknown asset type %s for asset %d", raw.AssetType, raw.ID)
+	}
+
+	return asset, nil
+}
+
+// Total number of lectures in the course
+func (c *Course) LectureCount() int {
+	count := 0
+	for _, chapter := range c.Chapters {
+		count += len(chapter.Lectures)
+	}
+	return count
+}
+
+// The main asset of a lecture followed by its supplementary assets
+func (l *Lecture) Assets() []*Asset {
+	assets := []*Asset{}
+	if l.Asset != nil {
+		assets = append(assets, l.Asset)
+	}
+	return append(assets, l.SupplementaryAssets...)
+}
+
+// Whether a video is DRM protected, only videos with a license token and no progressive source are.
+// DRM courses can have unprotected videos, protected HLS streams are caught by ErrHLSDRM instead.
+func (v *VideoAsset) IsDRM() bool {
+	if len(v.Sources()) > 0 {
+		return false
+	}
+	return v.MediaLicenseToken != ""
+}
@@ -0,0 +1,200 @@
+package main
+
+import (
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+// Loads a recorded cached-subscriber-curriculum-items response from testdata
+func loadCurriculumFixture(t *testing.T) []UdemyCurriculumItem {
+	t.Helper()
+
+	data, err := os.ReadFile(filepath.Join("testdata", "curriculum_items.json"))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	page := UdemyPagedResponse{}
+	if err := json.Unmarshal(data, &page); err != nil {
+		t.Fatal(err)
+	}
+	items := []UdemyCurriculumItem{}
+	if err := json.Unmarshal(page.Results, &items); err != nil {
+		t.Fatal(err)
+	}
+	return items
+}
+
+func buildFixtureCourse(t *testing.T) *Course {
+	t.Helper()
+
+	info := &UdemyCourse{ID: 42, Title: "Fixture Course", PublishedTitle: "fixture-course"}
+	course, err := BuildCourse(info, "www", loadCurriculumFixture(t))
+	if err != nil {
+		t.Fatal(err)
+	}
+	return course
+}
+
+func TestBuildCourseStructure(t *testing.T) {
+	course := buildFixtureCourse(t)
+
+	if course.ID != 42 || course.Title != "Fixture Course" || course.Slug != "fixture-course" || course.PortalName != "www" {
+		t.Errorf("unexpected course header: %+v", course)
+	}
+
+	expected := []struct {
+		title    string
+		index    int
+		lectures []int
+	}{
+		// the lecture before the first chapter gets a chapter named after the course
+		{"Fixture Course", 0, []int{1001}},
+		// the quiz is skipped
+		{"Getting Started", 1, []int{1002}},
+		// the practice test is skipped
+		{"Going Further", 2, []int{1003, 1004, 1005, 1006}},
+	}
+
+	if len(course.Chapters) != len(expected) {
+		t.Fatalf("got %d chapters, expected %d", len(course.Chapters), len(expected))
+	}
+	for i, want := range expected {
+		chapter := course.Chapters[i]
+		if chapter.Title != want.title || chapter.Index != want.index {
+			t.Errorf("chapter %d: got %q (index %d), expected %q (index %d)", i, chapter.Title, chapter.Index, want.title, want.index)
+		}
+		if len(chapter.Lectures) != len(want.lectures) {
+			t.Errorf("chapter %d: got %d lectures, expected %d", i, len(chapter.Lectures), len(want.lectures))
+			continue
+		}
+		for j, id := range want.lectures {
+			if chapter.Lectures[j].ID != id {
+				t.Errorf("chapter %d lecture %d: got id %d, expected %d", i, j, chapter.Lectures[j].ID, id)
+			}
+		}
+	}
+
+	if course.LectureCount() != 6 {
+		t.Errorf("got %d lectures, expected 6", course.LectureCount())
+	}
+}
+
+func TestBuildCourseAssetPayloads(t *testing.T) {
+	course := buildFixtureCourse(t)
+	lectures := map[int]*Lecture{}
+	for _, chapter := range course.Chapters {
+		for _, lecture := range chapter.Lectures {
+			lectures[lecture.ID] = lecture
+		}
+	}
+
+	video := lectures[1001].Asset
+	if video.Type != AssetTypeVideo || video.Video == nil || video.TimeEstimation != 95 {
+		t.Fatalf("unexpected video asset: %+v", video)
+	}
+	if len(video.Video.DownloadURLs) != 2 || video.Video.DownloadURLs[0].Label != "720" {
+		t.Errorf("unexpected download urls: %+v", video.Video.DownloadURLs)
+	}
+	if len(video.Video.StreamURLs) != 1 || video.Video.StreamURLs[0].Type != "application/x-mpegURL" {
+		t.Errorf("unexpected stream urls: %+v", video.Video.StreamURLs)
+	}
+	if len(video.Video.MediaSources) != 2 || len(video.Video.Captions) != 1 || video.Video.Captions[0].Locale != "en_US" {
+		t.Errorf("unexpected media sources or captions: %+v", video.Video)
+	}
+	if video.Article != nil || video.File != nil || video.ExternalLink != nil || video.Presentation != nil {
+		t.Errorf("video asset has other payloads: %+v", video)
+	}
+
+	article := lectures[1002].Asset
+	if article.Type != AssetTypeArticle || article.Article == nil || article.Article.Body != "<p>Read <b>this</b> first.</p>" {
+		t.Errorf("unexpected article asset: %+v", article)
+	}
+
+	supplementary := lectures[1002].SupplementaryAssets
+	if len(supplementary) != 2 {
+		t.Fatalf("got %d supplementary assets, expected 2", len(supplementary))
+	}
+	if file := supplementary[0]; file.Type != AssetTypeFile || file.File == nil || firstDownloadURL(file.File.DownloadURLs) != "https://att-c.udemycdn.com/cheatsheet.pdf" {
+		t.Errorf("unexpected file asset: %+v", file)
+	}
+	if link := supplementary[1]; link.Type != AssetTypeExternalLink || link.ExternalLink == nil || link.ExternalLink.URL != "https://go.dev/doc/" {
+		t.Errorf("unexpected external link asset: %+v", link)
+	}
+
+	// E-Books keep their download_urls under the "E-Book" key
+	ebook := lectures[1003].Asset
+	if ebook.Type != AssetTypeEBook || ebook.File == nil || firstDownloadURL(ebook.File.DownloadURLs) != "https://att-c.udemycdn.com/book.pdf" {
+		t.Errorf("unexpected e-book asset: %+v", ebook)
+	}
+
+	presentation := lectures[1004].Asset
+	if presentation.Type != AssetTypePresentation || presentation.Presentation == nil {
+		t.Fatalf("unexpected presentation asset: %+v", presentation)
+	}
+	if len(presentation.Presentation.SlideURLs) != 2 || firstDownloadURL(presentation.Presentation.DownloadURLs) != "https://att-c.udemycdn.com/slides.pdf" {
+		t.Errorf("unexpected presentation payload: %+v", presentation.Presentation)
+	}
+
+	protected := lectures[1005].Asset.Video
+	if protected.MediaLicenseToken == "" || !protected.CourseIsDRMed {
+		t.Errorf("DRM fields not parsed: %+v", protected)
+	}
+
+	if lectures[1006].Asset != nil || lectures[1006].SupplementaryAssets == nil {
+		t.Errorf("unexpected lecture without asset: %+v", lectures[1006])
+	}
+}
+
+func TestVideoAssetIsDRM(t *testing.T) {
+	progressive := []UdemyDownloadURL{{Type: "video/mp4", File: "https://x/720.mp4", Label: "720"}}
+	hls := []UdemyDownloadURL{{Type: "application/x-mpegURL", File: "https://x/index.m3u8", Label: "auto"}}
+
+	tests := []struct {
+		name     string
+		video    VideoAsset
+		expected bool
+	}{
+		{"license token", VideoAsset{StreamURLs: hls, MediaLicenseToken: "token"}, true},
+		{"license token with a progressive source", VideoAsset{DownloadURLs: progressive, MediaLicenseToken: "token"}, false},
+		// an unprotected video in a DRM course, a protected playlist is reported by the HLS downloader
+		{"DRM course", VideoAsset{StreamURLs: hls, CourseIsDRMed: true}, false},
+		{"plain", VideoAsset{DownloadURLs: progressive}, false},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			if got := test.video.IsDRM(); got != test.expected {
+				t.Errorf("got %v, expected %v", got, test.expected)
+			}
+		})
+	}
+}
+
+func TestParseLectureErrors(t *testing.T) {
+	item := UdemyCurriculumItem{Class: "lecture", ID: 7, Asset: &UdemyAsset{ID: 70}}
+	if _, err := ParseLecture(item); err == nil {
+		t.Error("expected an error for an asset without asset_type")
+	}
+
+	item = UdemyCurriculumItem{Class: "lecture", ID: 8, SupplementaryAssets: []UdemyAsset{{ID: 80}}}
+	if _, err := ParseLecture(item); err == nil {
+		t.Error("expected an error for a supplementary asset without asset_type")
+	}
+
+	if _, err := BuildCourse(&UdemyCourse{ID: 1}, "www", []UdemyCurriculumItem{item}); err == nil {
+		t.Error("expected BuildCourse to return the lecture error")
+	}
+}
+
+func TestParseAssetUnknownType(t *testing.T) {
+	asset, err := ParseAsset(UdemyAsset{ID: 1, AssetType: "Audio", Title: "a"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if asset.Type != "Audio" || asset.Video != nil || asset.Article != nil || asset.File != nil {
+		t.Errorf("unknown asset types should only keep the common fields: %+v", asset)
+	}
+}
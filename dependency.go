@@ -0,0 +1,297 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"sync"
+)
+
+// An external tool we need, adding a tool means adding a type that implements this and registering it
+type Dependency interface {
+	Name() string
+	// Looks for an existing install, returns nil when there is none
+	Detect() (*DependencyInstall, error)
+	LatestVersion() (string, error)
+	// Installs the given version into the managed bin directory, replacing any older managed install
+	Install(version string) error
+	// Path of the managed binary, only valid once it is installed
+	BinaryPath() string
+	// Runs the binary to get its version, this also checks that it works
+	Version(binary string) (string, error)
+}
+
+type DependencyInstall struct {
+	Path    string
+	Version string
+	// System installs come from the PATH or the user and are never updated by us
+	System bool
+}
+
+// Outcome of checking a single dependency
+type DependencyResult struct {
+	Name          string
+	Required      bool
+	Path          string
+	Version       string
+	LatestVersion string
+	System        bool
+	Updated       bool
+	Err           error
+}
+
+func (r *DependencyResult) OK() bool {
+	return r.Err == nil && r.Path != ""
+}
+
+type DependencyReport struct {
+	Results []*DependencyResult
+}
+
+// True when all the required dependencies are available
+func (r *DependencyReport) OK() bool {
+	for _, result := range r.Results {
+		if result.Required && !result.OK() {
+			return false
+		}
+	}
+	return true
+}
+
+// Gets the result of a dependency by name, nil if it wasn't checked
+func (r *DependencyReport) Get(name string) *DependencyResult {
+	for _, result := range r.Results {
+		if result.Name == name {
+			return result
+		}
+	}
+	return nil
+}
+
+// How a single dependency is checked
+type DependencyOptions struct {
+	Required bool
+	// Offline only accepts an existing install, nothing is looked up or downloaded
+	Offline bool
+	// Path is an explicit binary given by the user, it is used as is
+	Path   string
+	Policy VersionPolicy
+}
+
+type registeredDependency struct {
+	dependency Dependency
+	options    DependencyOptions
+}
+
+type DependencyRegistry struct {
+	dependencies []registeredDependency
+}
+
+func NewDependencyRegistry() *DependencyRegistry {
+	return &DependencyRegistry{}
+}
+
+func (r *DependencyRegistry) Register(dependency Dependency, required bool) {
+	r.dependencies = append(r.dependencies, registeredDependency{dependency: dependency, options: DependencyOptions{Required: required}})
+}
+
+// Changes the options of a registered dependency
+func (r *DependencyRegistry) Configure(name string, configure func(options *DependencyOptions)) error {
+	for i := range r.dependencies {
+		if r.dependencies[i].dependency.Name() == name {
+			configure(&r.dependencies[i].options)
+			return nil
+		}
+	}
+	return fmt.Errorf("Unknown dependency: %s", name)
+}
+
+// Only accept existing installs for every dependency
+func (r *DependencyRegistry) SetOffline(offline bool) {
+	for i := range r.dependencies {
+		r.dependencies[i].options.Offline = offline
+	}
+}
+
+// Checks every registered dependency, installing or updating them where needed. The results keep the registration order.
+func (r *DependencyRegistry) Run(parallel bool) *DependencyReport {
+	Info("Starting dependency check")
+
+	report := &DependencyReport{Results: make([]*DependencyResult, len(r.dependencies))}
+
+	// ensure the main bin directory exists
+	err := EnsureDirExist("bin")
+	if err != nil {
+		for i, registered := range r.dependencies {
+			report.Results[i] = &DependencyResult{Name: registered.dependency.Name(), Required: registered.options.Required, Err: fmt.Errorf("Error creating bin directory: %s", err)}
+		}
+		return report
+	}
+
+	wg := sync.WaitGroup{}
+	for i, registered := range r.dependencies {
+		if !parallel {
+			report.Results[i] = CheckDependency(registered.dependency, registered.options)
+			continue
+		}
+
+		wg.Add(1)
+		go func(i int, registered registeredDependency) {
+			defer wg.Done()
+			report.Results[i] = CheckDependency(registered.dependency, registered.options)
+		}(i, registered)
+	}
+	wg.Wait()
+
+	return report
+}
+
+// Detects a dependency and installs or updates it when the options allow and require it
+func CheckDependency(dependency Dependency, options DependencyOptions) *DependencyResult {
+	if options.Path != "" {
+		return checkDependencyPath(dependency, options)
+	}
+
+	name := dependency.Name()
+	policy := options.Policy
+	result := &DependencyResult{Name: name, Required: options.Required}
+	Infof("Checking %s...", name)
+
+	install, err := dependency.Detect()
+	if err != nil {
+		result.Err = fmt.Errorf("Error detecting %s: %s", name, err)
+		return result
+	}
+
+	if install != nil {
+		result.Path = install.Path
+		result.Version = install.Version
+		result.System = install.System
+
+		if install.System {
+			Successf("%s %s appears to be installed already, probably via a package manager.", name, install.Version)
+			warnUnsatisfiedPolicy(name, install.Version, policy)
+			return result
+		}
+
+		if policy.Satisfied(install.Version) {
+			Successf("%s %s satisfies the required version %s", name, install.Version, policy)
+			return result
+		}
+	}
+
+	if options.Offline {
+		if install == nil {
+			result.Err = fmt.Errorf("%s is not installed and can't be downloaded with the dependency check skipped", name)
+			return result
+		}
+		Successf("Using %s %s, skipped checking for updates", name, install.Version)
+		warnUnsatisfiedPolicy(name, install.Version, policy)
+		return result
+	}
+
+	// a pinned version is installed as is, there is no need to know the latest one
+	targetVersion := policy.Version
+	if policy.Mode != VersionPolicyPinned {
+		latestVersion, err := dependency.LatestVersion()
+		if err != nil {
+			// an existing install is still usable when we can't check for updates
+			if install != nil {
+				Warningf("Could not check for %s updates, using %s: %s", name, install.Version, err)
+				return result
+			}
+			result.Err = fmt.Errorf("Error getting latest %s version: %s", name, err)
+			return result
+		}
+		result.LatestVersion = latestVersion
+		targetVersion = latestVersion
+
+		if policy.Mode == VersionPolicyMinimum && !policy.Satisfied(latestVersion) {
+			result.Err = fmt.Errorf("The latest %s version %s doesn't satisfy the required version %s", name, latestVersion, policy)
+			return result
+		}
+	}
+
+	if install != nil {
+		if policy.Mode == VersionPolicyLatest && !IsOutdated(install.Version, targetVersion) {
+			Successf("%s is up to date, current version: %s, latest version: %s", name, install.Version, targetVersion)
+			return result
+		}
+		Warningf("%s %s doesn't match the required version %s, installing %s", name, install.Version, policy, targetVersion)
+	} else {
+		Warningf("%s not found, downloading %s...", name, targetVersion)
+	}
+
+	err = dependency.Install(targetVersion)
+	if err != nil {
+		result.Err = err
+		return result
+	}
+
+	result.Path = dependency.BinaryPath()
+	result.Version = targetVersion
+	result.Updated = true
+	return result
+}
+
+// Validates a binary given by the user by running its version command, it is never updated
+func checkDependencyPath(dependency Dependency, options DependencyOptions) *DependencyResult {
+	name := dependency.Name()
+	path := options.Path
+	result := &DependencyResult{Name: name, Required: options.Required}
+	Infof("Checking %s at %s...", name, path)
+
+	version, err := dependency.Version(path)
+	if err != nil {
+		result.Err = fmt.Errorf("%s is not a working %s binary: %s", path, name, err)
+		return result
+	}
+
+	result.Path = path
+	result.Version = version
+	result.System = true
+	Successf("Using %s %s from %s", name, version, path)
+	warnUnsatisfiedPolicy(name, version, options.Policy)
+	return result
+}
+
+// Installs we don't manage are used anyway, but the user should know when they don't match the policy
+func warnUnsatisfiedPolicy(name, version string, policy VersionPolicy) {
+	if policy.Mode != VersionPolicyLatest && !policy.Satisfied(version) {
+		Warningf("%s %s doesn't satisfy the required version %s", name, version, policy)
+	}
+}
+
+// Describes an install found on the PATH, a version we can't read doesn't make it unusable
+func detectSystemInstall(command string, getVersion func(binary string) (string, error)) *DependencyInstall {
+	version, err := getVersion(command)
+	if err != nil {
+		Debugf("Could not get the version of %s: %s", command, err)
+		version = "unknown"
+	}
+
+	return &DependencyInstall{Path: command, Version: version, System: true}
+}
+
+// Detects an install we manage ourselves, it needs both the binary and the version file
+func detectManagedInstall(dir, binary string) (*DependencyInstall, error) {
+	if !VersionFileExists(dir) || !FileExists(binary) {
+		return nil, nil
+	}
+
+	version, err := ReadVersionFile(dir)
+	if err != nil {
+		return nil, fmt.Errorf("Failed to read version file: %s", err)
+	}
+
+	return &DependencyInstall{Path: binary, Version: version}, nil
+}
+
+// Removes a managed install and recreates its empty directory
+func resetDependencyDir(dir string) error {
+	err := os.RemoveAll(dir)
+	if err != nil {
+		return err
+	}
+
+	return EnsureDirExist(dir)
+}
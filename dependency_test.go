@@ -0,0 +1,221 @@
+package main
+
+import (
+	"errors"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func registeredDependencyNames(registry *DependencyRegistry) []string {
+	names := []string{}
+	for _, registered := range registry.dependencies {
+		names = append(names, registered.dependency.Name())
+	}
+	return names
+}
+
+func TestNewDefaultDependencyRegistry(t *testing.T) {
+	names := registeredDependencyNames(NewDefaultDependencyRegistry(false))
+	if !reflect.DeepEqual(names, []string{"FFMPEG"}) {
+		t.Errorf("only FFMPEG is needed with the native backend, got %v", names)
+	}
+
+	registry := NewDefaultDependencyRegistry(true)
+	names = registeredDependencyNames(registry)
+	if !reflect.DeepEqual(names, []string{"FFMPEG", "aria2"}) {
+		t.Errorf("the aria2 backend needs aria2, got %v", names)
+	}
+	for _, registered := range registry.dependencies {
+		if !registered.options.Required {
+			t.Errorf("%s should be required", registered.dependency.Name())
+		}
+	}
+}
+
+// A dependency that never touches the network or runs anything
+type fakeDependency struct {
+	install       *DependencyInstall
+	latestVersion string
+	latestErr     error
+	binaryVersion string
+
+	latestCalls int
+	installed   []string
+}
+
+func (d *fakeDependency) Name() string {
+	return "fake"
+}
+
+func (d *fakeDependency) Detect() (*DependencyInstall, error) {
+	return d.install, nil
+}
+
+func (d *fakeDependency) LatestVersion() (string, error) {
+	d.latestCalls++
+	return d.latestVersion, d.latestErr
+}
+
+func (d *fakeDependency) Install(version string) error {
+	d.installed = append(d.installed, version)
+	return nil
+}
+
+func (d *fakeDependency) BinaryPath() string {
+	return "bin/fake/fake"
+}
+
+func (d *fakeDependency) Version(binary string) (string, error) {
+	if d.binaryVersion == "" {
+		return "", errors.New("not a fake binary")
+	}
+	return d.binaryVersion, nil
+}
+
+func TestCheckDependency(t *testing.T) {
+	managed := func(version string) *DependencyInstall {
+		return &DependencyInstall{Path: "bin/fake/fake", Version: version}
+	}
+	latest := VersionPolicy{Mode: VersionPolicyLatest}
+
+	tests := []struct {
+		name       string
+		dependency *fakeDependency
+		options    DependencyOptions
+		installed  []string
+		version    string
+		system     bool
+		err        string
+	}{
+		{
+			name:       "missing",
+			dependency: &fakeDependency{latestVersion: "2.0"},
+			options:    DependencyOptions{Policy: latest},
+			installed:  []string{"2.0"},
+			version:    "2.0",
+		},
+		{
+			name:       "outdated",
+			dependency: &fakeDependency{install: managed("1.0"), latestVersion: "2.0"},
+			options:    DependencyOptions{Policy: latest},
+			installed:  []string{"2.0"},
+			version:    "2.0",
+		},
+		{
+			name:       "up to date",
+			dependency: &fakeDependency{install: managed("2.0"), latestVersion: "2.0"},
+			options:    DependencyOptions{Policy: latest},
+			version:    "2.0",
+		},
+		{
+			name:       "system installs are never updated",
+			dependency: &fakeDependency{install: &DependencyInstall{Path: "fake", Version: "1.0", System: true}, latestVersion: "2.0"},
+			options:    DependencyOptions{Policy: latest},
+			version:    "1.0",
+			system:     true,
+		},
+		{
+			name:       "offline without an install",
+			dependency: &fakeDependency{latestVersion: "2.0"},
+			options:    DependencyOptions{Policy: latest, Offline: true},
+			err:        "can't be downloaded",
+		},
+		{
+			name:       "offline with an outdated install",
+			dependency: &fakeDependency{install: managed("1.0"), latestVersion: "2.0"},
+			options:    DependencyOptions{Policy: latest, Offline: true},
+			version:    "1.0",
+		},
+		{
+			name:       "pinned",
+			dependency: &fakeDependency{install: managed("1.0"), latestErr: errors.New("offline")},
+			options:    DependencyOptions{Policy: VersionPolicy{Mode: VersionPolicyPinned, Version: "1.5"}},
+			installed:  []string{"1.5"},
+			version:    "1.5",
+		},
+		{
+			name:       "pinned and installed",
+			dependency: &fakeDependency{install: managed("1.5")},
+			options:    DependencyOptions{Policy: VersionPolicy{Mode: VersionPolicyPinned, Version: "1.5"}},
+			version:    "1.5",
+		},
+		{
+			name:       "minimum newer than the latest release",
+			dependency: &fakeDependency{latestVersion: "2.0"},
+			options:    DependencyOptions{Policy: VersionPolicy{Mode: VersionPolicyMinimum, Version: "3.0"}},
+			err:        "doesn't satisfy the required version",
+		},
+		{
+			name:       "no update check keeps the install",
+			dependency: &fakeDependency{install: managed("1.0"), latestErr: errors.New("rate limited")},
+			options:    DependencyOptions{Policy: latest},
+			version:    "1.0",
+		},
+		{
+			name:       "no update check without an install",
+			dependency: &fakeDependency{latestErr: errors.New("rate limited")},
+			options:    DependencyOptions{Policy: latest},
+			err:        "rate limited",
+		},
+		{
+			name:       "explicit path",
+			dependency: &fakeDependency{binaryVersion: "0.9", latestVersion: "2.0"},
+			options:    DependencyOptions{Policy: latest, Path: "/opt/fake"},
+			version:    "0.9",
+			system:     true,
+		},
+		{
+			name:       "explicit path that doesn't work",
+			dependency: &fakeDependency{latestVersion: "2.0"},
+			options:    DependencyOptions{Policy: latest, Path: "/opt/fake"},
+			err:        "is not a working fake binary",
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			result := CheckDependency(test.dependency, test.options)
+			if test.err != "" {
+				if result.Err == nil || !strings.Contains(result.Err.Error(), test.err) {
+					t.Fatalf("expected an error containing %q, got %v", test.err, result.Err)
+				}
+				if len(test.dependency.installed) > 0 {
+					t.Errorf("nothing should have been installed, got %v", test.dependency.installed)
+				}
+				return
+			}
+			if result.Err != nil {
+				t.Fatal(result.Err)
+			}
+
+			if !reflect.DeepEqual(test.dependency.installed, test.installed) {
+				t.Errorf("installed %v, expected %v", test.dependency.installed, test.installed)
+			}
+			if result.Version != test.version || result.System != test.system || result.Updated != (len(test.installed) > 0) {
+				t.Errorf("got %+v", result)
+			}
+			if test.options.Policy.Mode == VersionPolicyPinned && test.dependency.latestCalls > 0 {
+				t.Error("a pinned version shouldn't look up the latest release")
+			}
+		})
+	}
+}
+
+func TestDependencyReportOK(t *testing.T) {
+	report := &DependencyReport{Results: []*DependencyResult{
+		{Name: "FFMPEG", Required: true, Path: "ffmpeg", Version: "6.0"},
+		{Name: "aria2", Required: false, Err: errors.New("not found")},
+	}}
+	if !report.OK() {
+		t.Error("an optional dependency failing shouldn't fail the report")
+	}
+	if report.Get("aria2") == nil || report.Get("yt-dlp") != nil {
+		t.Error("Get should only find checked dependencies")
+	}
+
+	report.Results[1].Required = true
+	if report.OK() {
+		t.Error("a required dependency failing should fail the report")
+	}
+}
@@ -0,0 +1,457 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/schollz/progressbar/v3"
+)
+
+// Returned for videos that can't be downloaded because of DRM, the lecture is skipped instead of failing
+var ErrDRMProtected = errors.New("the video is protected by DRM")
+
+// Something that can download a URL to a file, the file must only appear under its final name once it is complete
+type DownloadBackend interface {
+	Download(ctx context.Context, url, filepath string, newBar ProgressFactory) error
+}
+
+// Downloads with our own HTTP client
+type NativeBackend struct{}
+
+func (NativeBackend) Download(ctx context.Context, url, filepath string, newBar ProgressFactory) error {
+	return DownloadFileContext(ctx, url, filepath, newBar)
+}
+
+// Walks the curriculum and downloads the lectures with a pool of workers, lecture details are fetched as each lecture is reached
+type CourseDownloader struct {
+	// Client is used to refresh the lecture details before downloading, nil when the course was loaded from a file
+	Client      *UdemyClient
+	Backend     DownloadBackend
+	OutputDir   string
+	Concurrency int
+	Quality     QualityPreference
+	// HLS downloads videos that only have an HLS playlist, nil skips them
+	HLS *HLSDownloader
+	// Captions picks the caption languages to download, CaptionFormat is srt or vtt
+	Captions      CaptionSelection
+	CaptionFormat string
+	// ArticleMarkdown also saves articles as Markdown next to the HTML
+	ArticleMarkdown bool
+
+	// relative links in articles are resolved against it
+	portalURL string
+
+	mu       sync.Mutex
+	failures []string
+	// lectures whose video was skipped because of DRM
+	skipped []string
+}
+
+type lectureJob struct {
+	chapterNumber int
+	chapter       *Chapter
+	lectureNumber int
+	lecture       *Lecture
+}
+
+func NewCourseDownloader(client *UdemyClient, outputDir string, concurrency int) *CourseDownloader {
+	if concurrency < 1 {
+		concurrency = 1
+	}
+
+	return &CourseDownloader{
+		Client:        client,
+		Backend:       NativeBackend{},
+		OutputDir:     outputDir,
+		Concurrency:   concurrency,
+		Quality:       QualityPreference{Mode: QualityBest},
+		CaptionFormat: "srt",
+	}
+}
+
+func (d *CourseDownloader) Run(ctx context.Context, course *Course) error {
+	courseDir := filepath.Join(d.OutputDir, SanitizeFilename(CourseDirName(course)))
+	err := EnsureDirExist(courseDir)
+	if err != nil {
+		return fmt.Errorf("Error creating course directory: %s", err)
+	}
+	portalName := course.PortalName
+	if portalName == "" {
+		portalName = "www"
+	}
+	d.portalURL = strings.Replace(PORTAL_URL, "{portal_name}", portalName, 1)
+
+	WithFields(Fields{"course_id": course.ID}).Infof("Downloading %d lectures to %s", course.LectureCount(), courseDir)
+
+	progress := NewMultiProgress()
+	overall := progressbar.NewOptions(course.LectureCount(),
+		progressbar.OptionSetWriter(progress.AddLine()),
+		progressbar.OptionEnableColorCodes(true),
+		progressbar.OptionShowCount(),
+		progressbar.OptionSetWidth(30),
+		progressbar.OptionSetDescription("[cyan]Course[reset]"))
+
+	jobs := make(chan lectureJob)
+	wg := sync.WaitGroup{}
+	for i := 0; i < d.Concurrency; i++ {
+		line := progress.AddLine()
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for job := range jobs {
+				err := d.processLecture(ctx, course, courseDir, job, line)
+				if err != nil && ctx.Err() == nil {
+					d.addFailure(fmt.Sprintf("%03d %s: %s", job.lectureNumber, job.lecture.Title, err))
+				}
+				overall.Add(1)
+			}
+		}()
+	}
+
+	// producer, stops handing out lectures as soon as we get cancelled
+	lectureNumber := 0
+produce:
+	for i, chapter := range course.Chapters {
+		for _, lecture := range chapter.Lectures {
+			lectureNumber++
+			job := lectureJob{chapterNumber: i + 1, chapter: chapter, lectureNumber: lectureNumber, lecture: lecture}
+			select {
+			case jobs <- job:
+			case <-ctx.Done():
+				break produce
+			}
+		}
+	}
+	close(jobs)
+	wg.Wait()
+
+	if ctx.Err() != nil {
+		return ctx.Err()
+	}
+
+	if len(d.skipped) > 0 {
+		sort.Strings(d.skipped)
+		Warningf("Skipped the DRM protected videos of %d lectures, their other files were downloaded:", len(d.skipped))
+		for _, skipped := range d.skipped {
+			Warningf("    %s", skipped)
+		}
+	}
+
+	if len(d.failures) > 0 {
+		for _, failure := range d.failures {
+			Error(failure)
+		}
+		return fmt.Errorf("%d of %d lectures failed to download", len(d.failures), course.LectureCount())
+	}
+
+	return nil
+}
+
+func (d *CourseDownloader) addFailure(failure string) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	d.failures = append(d.failures, failure)
+}
+
+func (d *CourseDownloader) addSkipped(lecture string) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	d.skipped = append(d.skipped, lecture)
+}
+
+func (d *CourseDownloader) processLecture(ctx context.Context, course *Course, courseDir string, job lectureJob, line io.Writer) error {
+	if ctx.Err() != nil {
+		return ctx.Err()
+	}
+
+	lecture := d.refreshLecture(course, job.lecture)
+	log := WithFields(Fields{"course_id": course.ID, "lecture_id": lecture.ID})
+	if lecture.Asset != nil && lecture.Asset.Video != nil && job.lecture.Asset != nil && job.lecture.Asset.Video != nil {
+		// the quality of an earlier download lives in the course information, not in the fresh lecture data
+		lecture.Asset.Video.SelectedQuality = job.lecture.Asset.Video.SelectedQuality
+	}
+
+	chapterDir := filepath.Join(courseDir, ChapterDirName(job.chapterNumber, job.chapter))
+	err := EnsureDirExist(chapterDir)
+	if err != nil {
+		return err
+	}
+
+	base := LectureBaseName(job.lectureNumber, lecture)
+	if lecture.Asset != nil {
+		err = d.downloadAsset(ctx, log, lecture.Asset, filepath.Join(chapterDir, base), "", line)
+		if errors.Is(err, ErrDRMProtected) {
+			// the supplementary assets aren't protected, keep going with those
+			log.Debugf("Skipping the video of %s: %s", lecture.Title, err)
+			d.addSkipped(fmt.Sprintf("%03d %s", job.lectureNumber, lecture.Title))
+		} else if err != nil {
+			return err
+		}
+
+		// record the quality on the course so it ends up in the saved course information
+		if lecture.Asset.Video != nil && job.lecture.Asset != nil && job.lecture.Asset.Video != nil {
+			job.lecture.Asset.Video.SelectedQuality = lecture.Asset.Video.SelectedQuality
+		}
+
+		if lecture.Asset.Video != nil && d.Captions.Enabled() {
+			err = d.downloadCaptions(ctx, log, lecture.Asset.Video, filepath.Join(chapterDir, base))
+			if err != nil {
+				return err
+			}
+		}
+	}
+
+	for _, asset := range lecture.SupplementaryAssets {
+		name := asset.Filename
+		if name == "" {
+			name = asset.Title
+		}
+		err = d.downloadAsset(ctx, log, asset, filepath.Join(chapterDir, base+" - "+SanitizeFilename(name)), filepath.Ext(asset.Filename), line)
+		if err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// Gets fresh asset URLs for the lecture, falls back to the curriculum data when that isn't possible
+func (d *CourseDownloader) refreshLecture(course *Course, lecture *Lecture) *Lecture {
+	if d.Client == nil {
+		return lecture
+	}
+
+	item, err := d.Client.GetLecture(course.ID, lecture.ID)
+	if err != nil {
+		Debugf("Using curriculum data for lecture %d: %s", lecture.ID, err)
+		return lecture
+	}
+
+	fresh, err := ParseLecture(*item)
+	if err != nil {
+		Debugf("Using curriculum data for lecture %d: %s", lecture.ID, err)
+		return lecture
+	}
+
+	// the lecture endpoint doesn't always include these
+	fresh.ID = lecture.ID
+	fresh.Index = lecture.Index
+	fresh.Title = lecture.Title
+	return fresh
+}
+
+// Downloads a single asset, path is the destination without extension unless ext is already part of it
+func (d *CourseDownloader) downloadAsset(ctx context.Context, log *LogEntry, asset *Asset, path, ext string, line io.Writer) error {
+	var url string
+	var video VideoSource
+	hls := false
+
+	switch asset.Type {
+	case AssetTypeVideo:
+		if asset.Video.IsDRM() {
+			return ErrDRMProtected
+		}
+
+		var ok bool
+		video, ok = SelectVideoSource(asset.Video, d.Quality)
+		if !ok {
+			url = asset.Video.HLSPlaylistURL()
+			if url == "" || d.HLS == nil {
+				return fmt.Errorf("no downloadable video source for asset %d", asset.ID)
+			}
+			hls = true
+		} else {
+			url = video.URL
+		}
+		ext = ".mp4"
+	case AssetTypeFile, AssetTypeEBook:
+		url = firstDownloadURL(asset.File.DownloadURLs)
+	case AssetTypePresentation:
+		url = firstDownloadURL(asset.Presentation.DownloadURLs)
+	case AssetTypeExternalLink:
+		return writeInternetShortcut(strings.TrimSuffix(path, ext)+".url", asset.ExternalLink.URL)
+	case AssetTypeArticle:
+		return d.saveArticle(ctx, log, asset, strings.TrimSuffix(path, ext))
+	default:
+		log.Debugf("Nothing to download for %s asset %d", asset.Type, asset.ID)
+		return nil
+	}
+
+	if url == "" {
+		return fmt.Errorf("no download URL for %s asset %d", asset.Type, asset.ID)
+	}
+
+	if ext == "" {
+		ext = filepath.Ext(asset.Filename)
+	}
+	if !strings.HasSuffix(path, ext) {
+		path += ext
+	}
+
+	if FileExists(path) {
+		log.Debugf("%s already exists, skipping", path)
+		if asset.Video != nil && asset.Video.SelectedQuality > 0 && video.Height > asset.Video.SelectedQuality {
+			log.WithFields(Fields{"asset_type": asset.Type}).Logf(NOTICE, "%s was downloaded in %dp, %dp is available now, delete it to download the upgrade", filepath.Base(path), asset.Video.SelectedQuality, video.Height)
+		}
+		return nil
+	}
+
+	description := filepath.Base(path)
+	if runes := []rune(description); len(runes) > 40 {
+		description = string(runes[:37]) + "..."
+	}
+
+	newBar := func(size int64) *progressbar.ProgressBar {
+		return NewDownloadBar(line, size, description)
+	}
+
+	start := time.Now()
+	var err error
+	if hls {
+		video.Height, err = d.HLS.Download(ctx, url, path, d.Quality, newBar)
+		if errors.Is(err, ErrHLSDRM) {
+			// only the playlist told us
+			err = fmt.Errorf("%w: %s", ErrDRMProtected, err)
+		}
+	} else {
+		err = d.Backend.Download(ctx, url, path, newBar)
+	}
+	if err != nil {
+		return err
+	}
+
+	fields := Fields{"asset_type": asset.Type, "duration": time.Since(start)}
+	if info, err := os.Stat(path); err == nil {
+		fields["bytes"] = info.Size()
+	}
+	if asset.Video != nil {
+		asset.Video.SelectedQuality = video.Height
+		fields["quality"] = video.Height
+	}
+	// without progress bars this is the only sign of progress
+	level := DEBUG
+	if !ShowProgress() {
+		level = INFO
+	}
+	log.WithFields(fields).Logf(level, "Downloaded %s", filepath.Base(path))
+	return nil
+}
+
+// Downloads the selected captions of a video next to it as <lecture>.<lang>.srt (or .vtt)
+func (d *CourseDownloader) downloadCaptions(ctx context.Context, log *LogEntry, video *VideoAsset, base string) error {
+	for _, caption := range video.Captions {
+		if caption.URL == "" || !d.Captions.Matches(caption.Locale) {
+			continue
+		}
+
+		path := fmt.Sprintf("%s.%s.%s", base, CaptionLanguage(caption), d.CaptionFormat)
+		if FileExists(path) {
+			log.Debugf("%s already exists, skipping", path)
+			continue
+		}
+
+		data, err := GetBytesContext(ctx, httpClient, caption.URL)
+		if err != nil {
+			return fmt.Errorf("Error downloading %s captions: %s", caption.Locale, err)
+		}
+
+		if d.CaptionFormat == "srt" && bytes.HasPrefix(bytes.TrimPrefix(data, []byte("\xef\xbb\xbf")), []byte("WEBVTT")) {
+			data, err = ConvertVTTToSRT(data)
+			if err != nil {
+				return fmt.Errorf("Error converting %s captions: %s", caption.Locale, err)
+			}
+		}
+
+		err = WriteFileAtomic(path, data)
+		if err != nil {
+			return err
+		}
+		log.WithFields(Fields{"asset_type": "Caption", "bytes": len(data)}).Debugf("Downloaded %s", filepath.Base(path))
+	}
+
+	return nil
+}
+
+// Saves an article as <lecture>.html with its images in <lecture>_files, and as <lecture>.md with -article-markdown
+func (d *CourseDownloader) saveArticle(ctx context.Context, log *LogEntry, asset *Asset, base string) error {
+	if asset.Article == nil || strings.TrimSpace(asset.Article.Body) == "" {
+		log.Debugf("Article asset %d has no body", asset.ID)
+		return nil
+	}
+
+	title := asset.Title
+	if title == "" {
+		title = filepath.Base(base)
+	}
+
+	htmlPath := base + ".html"
+	markdownPath := base + ".md"
+	htmlExists := FileExists(htmlPath)
+	if htmlExists && (!d.ArticleMarkdown || FileExists(markdownPath)) {
+		log.Debugf("%s already exists, skipping", htmlPath)
+		return nil
+	}
+
+	body, err := LocalizeArticle(ctx, asset.Article.Body, htmlPath, d.portalURL)
+	if err != nil {
+		return fmt.Errorf("Error saving article: %s", err)
+	}
+
+	if !htmlExists {
+		err = SaveArticle(title, body, htmlPath)
+		if err != nil {
+			return fmt.Errorf("Error saving article: %s", err)
+		}
+		log.WithFields(Fields{"asset_type": asset.Type}).Debugf("Saved %s", filepath.Base(htmlPath))
+	}
+
+	if d.ArticleMarkdown {
+		err = SaveArticleMarkdown(title, body, markdownPath)
+		if err != nil {
+			return fmt.Errorf("Error saving article: %s", err)
+		}
+		log.WithFields(Fields{"asset_type": asset.Type}).Debugf("Saved %s", filepath.Base(markdownPath))
+	}
+
+	return nil
+}
+
+func firstDownloadURL(urls []UdemyDownloadURL) string {
+	for _, u := range urls {
+		if u.File != "" {
+			return u.File
+		}
+	}
+	return ""
+}
+
+func writeInternetShortcut(path, url string) error {
+	if FileExists(path) {
+		return nil
+	}
+	return WriteFileAtomic(path, []byte(fmt.Sprintf("[InternetShortcut]\nURL=%s\n", url)))
+}
+
+func CourseDirName(course *Course) string {
+	if course.Slug != "" {
+		return course.Slug
+	}
+	return course.Title
+}
+
+func ChapterDirName(number int, chapter *Chapter) string {
+	return fmt.Sprintf("%02d - %s", number, SanitizeFilename(chapter.Title))
+}
+
+func LectureBaseName(number int, lecture *Lecture) string {
+	return fmt.Sprintf("%03d - %s", number, SanitizeFilename(lecture.Title))
+}
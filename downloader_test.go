@@ -0,0 +1,107 @@
+package main
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"testing"
+)
+
+func fileAsset(id int, filename, url string) *Asset {
+	return &Asset{ID: id, Type: AssetTypeFile, Title: filename, Filename: filename, File: &FileAsset{DownloadURLs: []UdemyDownloadURL{{File: url}}}}
+}
+
+func TestCourseDownloaderRun(t *testing.T) {
+	mu := sync.Mutex{}
+	requests := []string{}
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		mu.Lock()
+		requests = append(requests, r.URL.Path)
+		mu.Unlock()
+		if strings.HasPrefix(r.URL.Path, "/missing") {
+			http.NotFound(w, r)
+			return
+		}
+		w.Write([]byte("content of " + r.URL.Path))
+	}))
+	defer server.Close()
+
+	course := &Course{ID: 7, Title: "Pipeline Course", Slug: "pipeline-course", Chapters: []*Chapter{
+		{Title: "Intro", Lectures: []*Lecture{
+			{ID: 1, Title: "Welcome", Asset: &Asset{ID: 11, Type: AssetTypeVideo, Video: &VideoAsset{
+				DownloadURLs: []UdemyDownloadURL{{Type: "video/mp4", Label: "360", File: server.URL + "/video-360.mp4"}, {Type: "video/mp4", Label: "720", File: server.URL + "/video-720.mp4"}},
+			}}, SupplementaryAssets: []*Asset{
+				fileAsset(12, "slides.pdf", server.URL+"/slides.pdf"),
+				// the title isn't a filename, .js is not an extension
+				{ID: 13, Type: AssetTypeExternalLink, Title: "Intro to Node.js", ExternalLink: &ExternalLinkAsset{URL: "https://nodejs.org/"}},
+			}},
+			{ID: 2, Title: "Reading", Asset: &Asset{ID: 21, Type: AssetTypeArticle, Title: "Reading", Article: &ArticleAsset{Body: "<p>Read this</p>"}}},
+		}},
+		{Title: "Next Steps", Lectures: []*Lecture{
+			{ID: 3, Title: "Done Already", Asset: fileAsset(31, "done.zip", server.URL+"/done.zip")},
+			{ID: 4, Title: "Broken", Asset: fileAsset(41, "broken.zip", server.URL+"/missing-broken.zip")},
+			{ID: 5, Title: "Last", Asset: fileAsset(51, "last.zip", server.URL+"/last.zip"), SupplementaryAssets: []*Asset{
+				fileAsset(52, "notes.txt", server.URL+"/missing-notes.txt"),
+			}},
+		}},
+	}}
+
+	dir := t.TempDir()
+	courseDir := filepath.Join(dir, "pipeline-course")
+	done := filepath.Join(courseDir, "02 - Next Steps", "003 - Done Already.zip")
+	if err := EnsureDirExist(filepath.Dir(done)); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(done, []byte("finished earlier"), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	downloader := NewCourseDownloader(nil, dir, 1)
+	err := downloader.Run(context.Background(), course)
+	if err == nil || err.Error() != "2 of 5 lectures failed to download" {
+		t.Fatalf("expected the failures to be counted, got %v", err)
+	}
+	if len(downloader.failures) != 2 || !strings.HasPrefix(downloader.failures[0], "004 Broken: ") || !strings.HasPrefix(downloader.failures[1], "005 Last: ") {
+		t.Errorf("unexpected failures: %q", downloader.failures)
+	}
+
+	// lectures are downloaded in order, the finished file isn't requested again
+	expectedRequests := []string{"/video-720.mp4", "/slides.pdf", "/missing-broken.zip", "/last.zip", "/missing-notes.txt"}
+	if strings.Join(requests, " ") != strings.Join(expectedRequests, " ") {
+		t.Errorf("got requests %q, expected %q", requests, expectedRequests)
+	}
+
+	files := []string{}
+	filepath.Walk(courseDir, func(path string, info os.FileInfo, err error) error {
+		if err == nil && !info.IsDir() {
+			rel, _ := filepath.Rel(courseDir, path)
+			files = append(files, filepath.ToSlash(rel))
+		}
+		return nil
+	})
+	sort.Strings(files)
+	expectedFiles := []string{
+		"01 - Intro/001 - Welcome - Intro to Node.js.url",
+		"01 - Intro/001 - Welcome - slides.pdf",
+		"01 - Intro/001 - Welcome.mp4",
+		"01 - Intro/002 - Reading.html",
+		"02 - Next Steps/003 - Done Already.zip",
+		"02 - Next Steps/005 - Last.zip",
+	}
+	if strings.Join(files, "\n") != strings.Join(expectedFiles, "\n") {
+		t.Errorf("got files\n%s\nexpected\n%s", strings.Join(files, "\n"), strings.Join(expectedFiles, "\n"))
+	}
+
+	data, _ := os.ReadFile(done)
+	if string(data) != "finished earlier" {
+		t.Errorf("the finished file was overwritten with %q", data)
+	}
+	if quality := course.Chapters[0].Lectures[0].Asset.Video.SelectedQuality; quality != 720 {
+		t.Errorf("got selected quality %d, expected 720", quality)
+	}
+}
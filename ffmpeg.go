@@ -3,14 +3,19 @@ package main
 import (
 	"encoding/json"
 	"fmt"
+	"os"
+	"os/exec"
 	"path/filepath"
+	"regexp"
 	"runtime"
+	"strings"
 )
 
 type FFMPEGMacVersionDownloadInfo struct {
-	Url  string `json:"url"`
-	Size int    `json:"size"`
-	Sig  string `json:"sig"`
+	Url string `json:"url"`
+	// Size is in megabytes
+	Size float64 `json:"size"`
+	Sig  string  `json:"sig"`
 }
 
 type FFMPEGMacVersionDownload struct {
@@ -22,26 +27,150 @@ type FFMPEGMacVersion struct {
 	Name     string                   `json:"name"`
 	Type     string                   `json:"type"`
 	Version  string                   `json:"version"`
-	Size     int                      `json:"size"`
+	Size     float64                  `json:"size"`
 	Download FFMPEGMacVersionDownload `json:"download"`
 }
 
+// Where FFMPEG builds and their version information are downloaded from, tests can point these at a local server
+type FFMPEGSources struct {
+	WinLatestVersionURL string
+	WinSHAURL           string
+	WinURL              string
+	// the Mac builds are looked up by GOARCH, see macInfoURLs
+	MacInfoURLs           map[string]string
+	MacVersionInfoURLs    map[string]string
+	MacSigningKeyURL      string
+	MacSigningKeyID       uint64
+	LinuxLatestVersionURL string
+	LinuxURL              string
+}
+
+var DefaultFFMPEGSources = FFMPEGSources{
+	WinLatestVersionURL: FFMPEG_WIN_LATEST_VERSION_URL,
+	WinSHAURL:           FFMPEG_WIN_SHA_URL,
+	WinURL:              FFMPEG_WIN_URL,
+	// evermeet.cx only builds for intel, arm64 macs run them through Rosetta 2
+	MacInfoURLs:           map[string]string{"amd64": FFMPEG_MAC_INFO_URL},
+	MacVersionInfoURLs:    map[string]string{"amd64": FFMPEG_MAC_VERSION_INFO_URL},
+	MacSigningKeyURL:      FFMPEG_MAC_SIGNING_KEY_URL,
+	MacSigningKeyID:       FFMPEG_MAC_SIGNING_KEY_ID,
+	LinuxLatestVersionURL: FFMPEG_LINUX_LATEST_VERSION_URL,
+	LinuxURL:              FFMPEG_LINUX_URL,
+}
+
+type FFmpegDependency struct {
+	Dir     string
+	Sources FFMPEGSources
+}
+
+var ffmpegVersionRegex = regexp.MustCompile(`ffmpeg version (\S+)`)
+
+func NewFFmpegDependency() *FFmpegDependency {
+	return &FFmpegDependency{Dir: FFMPEG_BIN_DIRECTORY, Sources: DefaultFFMPEGSources}
+}
+
+func (d *FFmpegDependency) Name() string {
+	return "FFMPEG"
+}
+
+func (d *FFmpegDependency) BinaryPath() string {
+	if runtime.GOOS == "windows" {
+		return filepath.Join(d.Dir, "ffmpeg.exe")
+	}
+	return filepath.Join(d.Dir, "ffmpeg")
+}
+
+func (d *FFmpegDependency) Version(binary string) (string, error) {
+	return GetFFMPEGVersion(binary)
+}
+
+func (d *FFmpegDependency) Detect() (*DependencyInstall, error) {
+	// check if ffmpeg is installed externally
+	if CommandExists("ffmpeg") {
+		return detectSystemInstall("ffmpeg", GetFFMPEGVersion), nil
+	}
+
+	return detectManagedInstall(d.Dir, d.BinaryPath())
+}
+
+func (d *FFmpegDependency) LatestVersion() (string, error) {
+	return d.Sources.GetLatestFFMPEGVersion()
+}
+
+func (d *FFmpegDependency) Install(version string) error {
+	err := resetDependencyDir(d.Dir)
+	if err != nil {
+		return fmt.Errorf("Error creating ffmpeg directory: %s", err)
+	}
+
+	return d.Sources.DownloadFFMPEG(version, d.Dir)
+}
+
+// Runs ffmpeg -version and parses the version out of it
+func GetFFMPEGVersion(binary string) (string, error) {
+	out, err := exec.Command(binary, "-version").Output()
+	if err != nil {
+		return "", err
+	}
+
+	match := ffmpegVersionRegex.FindStringSubmatch(string(out))
+	if match == nil {
+		return "", fmt.Errorf("Could not find the ffmpeg version in the output of %s -version", binary)
+	}
+
+	return match[1], nil
+}
+
 // Gets the latest version number of FFMPEG for Windows
-func GetLatestWinFFMPEGVersion() (string, error) {
+func (s FFMPEGSources) GetLatestWinFFMPEGVersion() (string, error) {
 	//
-	return GetText(FFMPEG_WIN_LATEST_VERSION_URL)
+	return GetText(s.WinLatestVersionURL)
 }
 
-// Gets the latest version information of FFMPEG for Mac
-func GetLatestMacFFMPEGVersion() (string, error) {
-	var err error
+// Gets the info URLs of the Mac builds for an architecture, arm64 falls back to the intel builds
+func (s FFMPEGSources) macInfoURLs(arch string) (string, string, error) {
+	infoURL, ok := s.MacInfoURLs[arch]
+	if ok {
+		return infoURL, s.MacVersionInfoURLs[arch], nil
+	}
+
+	if arch == "arm64" {
+		if infoURL, ok := s.MacInfoURLs["amd64"]; ok {
+			return infoURL, s.MacVersionInfoURLs["amd64"], nil
+		}
+	}
+
+	return "", "", fmt.Errorf("Unsupported architecture for ffmpeg mac builds: %s", arch)
+}
+
+// Gets and parses an evermeet.cx info document
+func getMacFFMPEGInfo(url string) (*FFMPEGMacVersion, error) {
+	data, err := GetBytes(url)
+	if err != nil {
+		return nil, err
+	}
+
 	release := FFMPEGMacVersion{}
-	data, err := GetBytes(FFMPEG_MAC_INFO_URL)
+	err = json.Unmarshal(data, &release)
+	if err != nil {
+		return nil, fmt.Errorf("Error parsing ffmpeg version information: %s", err)
+	}
+
+	if release.Version == "" {
+		return nil, fmt.Errorf("No version in the ffmpeg version information at %s", url)
+	}
+
+	return &release, nil
+}
+
+// Gets the latest version information of FFMPEG for Mac
+func (s FFMPEGSources) GetLatestMacFFMPEGVersion() (string, error) {
+	infoURL, _, err := s.macInfoURLs(runtime.GOARCH)
 	if err != nil {
 		return "", err
 	}
 
-	err = json.Unmarshal(data, &version)
+	release, err := getMacFFMPEGInfo(infoURL)
 	if err != nil {
 		return "", err
 	}
@@ -49,26 +178,70 @@ func GetLatestMacFFMPEGVersion() (string, error) {
 	return release.Version, nil
 }
 
+// Picks the 7z archive, or the zip when there is no signed 7z, both need a signature
+func (r *FFMPEGMacVersion) archive() (*FFMPEGMacVersionDownloadInfo, string, error) {
+	if r.Download.SZ.Url != "" && r.Download.SZ.Sig != "" {
+		return &r.Download.SZ, ".7z", nil
+	}
+	if r.Download.Zip.Url != "" && r.Download.Zip.Sig != "" {
+		return &r.Download.Zip, ".zip", nil
+	}
+
+	if r.Download.SZ.Url != "" || r.Download.Zip.Url != "" {
+		return nil, "", fmt.Errorf("No signature published for ffmpeg %s, refusing to install it", r.Version)
+	}
+	return nil, "", fmt.Errorf("No download published for ffmpeg %s", r.Version)
+}
+
+var linuxFFMPEGVersionRegex = regexp.MustCompile(`(?m)^\s*version:\s*(\S+)`)
+
 // Gets the latest version of FFMPEG for Linux
-func GetLatestLinuxFFMPEGVersion() (string, error) {
-	// TODO: Implement
-	return "", nil
+func (s FFMPEGSources) GetLatestLinuxFFMPEGVersion() (string, error) {
+	readme, err := GetText(s.LinuxLatestVersionURL)
+	if err != nil {
+		return "", err
+	}
+
+	match := linuxFFMPEGVersionRegex.FindStringSubmatch(readme)
+	if match == nil {
+		return "", fmt.Errorf("Could not find the ffmpeg version in %s", s.LinuxLatestVersionURL)
+	}
+
+	return match[1], nil
 }
 
-func IsOutdated(currentVersion, latestVersion string) bool {
-	return latestVersion > currentVersion
+// Maps GOARCH to the architecture names used by the static Linux builds
+func GetLinuxFFMPEGArch() (string, error) {
+	switch runtime.GOARCH {
+	case "amd64":
+		return "amd64", nil
+	case "arm64":
+		return "arm64", nil
+	case "arm":
+		return "armhf", nil
+	case "386":
+		return "i686", nil
+	}
+
+	return "", fmt.Errorf("Unsupported architecture for ffmpeg static builds: %s", runtime.GOARCH)
 }
 
-func DownloadFFMPEGWindows(version, dir string) error {
+func (s FFMPEGSources) DownloadFFMPEGWindows(version, dir string) error {
 	var err error
 
 	filename := "ffmpeg-essentials_build.7z"
 	archivePath := filepath.Join(dir, filename)
 
+	// Get the published checksum
+	checksum, err := GetPublishedSHA256(fmt.Sprintf(s.WinSHAURL, version))
+	if err != nil {
+		return fmt.Errorf("Error getting ffmpeg checksum: %s", err)
+	}
+
 	// Download FFMPEG Archive
-	url := fmt.Sprintf(FFMPEG_WIN_URL, version)
+	url := fmt.Sprintf(s.WinURL, version)
 	Debugf("Downloading ffmpeg from: %s", url)
-	err = DownloadFile(url, archivePath)
+	err = DownloadFileSHA256(url, archivePath, checksum)
 	if err != nil {
 		return fmt.Errorf("Error downloading ffmpeg: %s", err)
 	}
@@ -81,72 +254,201 @@ func DownloadFFMPEGWindows(version, dir string) error {
 
 	// Extract the FFMPEG Archive
 	Debugf("Unzipping ffmpeg to %s...", dir)
-	err = DecompressWFilter(archivePath, dir, fmt.Sprintf("ffmpeg-%s-essentials_build/", version), []string{"bin/ffmpeg.exe"})
+	err = ExtractArchive(archivePath, dir, ExtractOptions{
+		StripPrefix: fmt.Sprintf("ffmpeg-%s-essentials_build/", version),
+		Filters:     []string{"bin/ffmpeg.exe"},
+		Flatten:     true,
+	})
 	if err != nil {
 		return fmt.Errorf("Error unzipping ffmpeg: %s", err)
 	}
 
-	return nil
+	return os.Remove(archivePath)
 }
 
-func DownloadFFMPEGMac(version, dir string) error {
+func (s FFMPEGSources) DownloadFFMPEGMac(version, dir string) error {
+	return s.downloadFFMPEGMac(version, dir, runtime.GOARCH)
+}
+
+func (s FFMPEGSources) downloadFFMPEGMac(version, dir, arch string) error {
 	var err error
 
-	filename := "ffmpeg.7z"
-	archivePath := filepath.Join(dir, filename)
+	infoURL, versionInfoURL, err := s.macInfoURLs(arch)
+	if err != nil {
+		return err
+	}
+	if _, ok := s.MacInfoURLs[arch]; !ok {
+		Warningf("There are no native ffmpeg builds for %s macs, installing the intel build which needs Rosetta 2", arch)
+	}
+
+	// Get the archive and signature URLs of this version, the latest snapshot can't be looked up by its version
+	release, err := getMacFFMPEGInfo(infoURL)
+	if err == nil && release.Version != version {
+		release, err = getMacFFMPEGInfo(fmt.Sprintf(versionInfoURL, version))
+	}
+	if err != nil {
+		return fmt.Errorf("Error getting ffmpeg version information: %s", err)
+	}
+
+	download, ext, err := release.archive()
+	if err != nil {
+		return err
+	}
+	archivePath := filepath.Join(dir, "ffmpeg"+ext)
 
 	// Download FFMPEG Archive
-	url := fmt.Sprintf(FFMPEG_MAC_VERSION_INFO_URL, version)
-	Debugf("Downloading ffmpeg from: %s", url)
-	err = DownloadFile(url, archivePath)
+	Debugf("Downloading ffmpeg from: %s", download.Url)
+	err = DownloadFileSizeHint(download.Url, archivePath, int64(download.Size*1024*1024))
 	if err != nil {
 		return fmt.Errorf("Error downloading ffmpeg: %s", err)
 	}
 
+	// Verify the archive before anything gets extracted from it
+	Debug("Verifying FFMPEG signature...")
+	err = VerifyPGPSignature(archivePath, download.Sig, s.MacSigningKeyURL, s.MacSigningKeyID)
+	if err != nil {
+		os.Remove(archivePath)
+		return fmt.Errorf("Error verifying ffmpeg archive, the archive has been deleted: %s", err)
+	}
+
 	Debug("Writing FFMPEG Version file...")
 	err = WriteVersionFile(dir, version)
 	if err != nil {
 		return fmt.Errorf("Error writing ffmpeg version file: %s", err)
 	}
 
-	// Extract the FFMPEG Archive
+	// Extract the FFMPEG Archive, evermeet archives only contain the binary
 	Debugf("Unzipping ffmpeg to %s...", dir)
-	err = DecompressWFilter(archivePath, dir, fmt.Sprintf("ffmpeg-%s/", version), []string{"ffmpeg"})
+	err = ExtractArchive(archivePath, dir, ExtractOptions{Filters: []string{"ffmpeg"}, Flatten: true})
 	if err != nil {
 		return fmt.Errorf("Error unzipping ffmpeg: %s", err)
 	}
 
-	return nil
+	err = os.Chmod(filepath.Join(dir, "ffmpeg"), 0755)
+	if err != nil {
+		return fmt.Errorf("Error making ffmpeg executable: %s", err)
+	}
+
+	return os.Remove(archivePath)
 }
 
-func DownloadFFMPEGLinux(version, dir string) error {
-	// TODO: At some point we should look into completing this
-	return fmt.Errorf("It looks like you're running linux, this script does not support installing FFMPEG binaries for linux yet :(\nPlease install FFMPEG via your systems package manager and re-run the script")
+var linuxFFMPEGRootRegex = regexp.MustCompile(`^ffmpeg-(.+)-[a-z0-9]+-static$`)
+
+// Gets the root directory of a static Linux build and the version it is named after, like ffmpeg-6.0-amd64-static
+func linuxFFMPEGArchiveRoot(archivePath string) (string, string, error) {
+	archive, err := OpenArchive(archivePath)
+	if err != nil {
+		return "", "", err
+	}
+	defer archive.Close()
+
+	entry, _, err := archive.Next()
+	if err != nil {
+		return "", "", err
+	}
+
+	root := strings.SplitN(strings.TrimPrefix(entry.Name, "./"), "/", 2)[0]
+	match := linuxFFMPEGRootRegex.FindStringSubmatch(root)
+	if match == nil {
+		return "", "", fmt.Errorf("Unexpected root directory %q in the ffmpeg archive", root)
+	}
+
+	return root, match[1], nil
+}
+
+// Only the latest release is published for Linux, so other versions are refused instead of installing the wrong one
+func (s FFMPEGSources) DownloadFFMPEGLinux(version, dir string) error {
+	var err error
+
+	arch, err := GetLinuxFFMPEGArch()
+	if err != nil {
+		return fmt.Errorf("%s\nPlease install FFMPEG via your systems package manager and re-run the script", err)
+	}
+
+	latest, err := s.GetLatestLinuxFFMPEGVersion()
+	if err != nil {
+		return fmt.Errorf("Error getting the latest ffmpeg version: %s", err)
+	}
+	if c, err := CompareVersions(version, latest); err != nil || c != 0 {
+		return fmt.Errorf("Only the latest ffmpeg release (%s) is published for Linux, install ffmpeg %s yourself and use -ffmpeg-path", latest, version)
+	}
+
+	filename := "ffmpeg-release-static.tar.xz"
+	archivePath := filepath.Join(dir, filename)
+
+	// Get the checksum published next to the archive
+	url := fmt.Sprintf(s.LinuxURL, arch)
+	checksum, err := GetPublishedMD5(url + ".md5")
+	if err != nil {
+		return fmt.Errorf("Error getting ffmpeg checksum: %s", err)
+	}
+
+	// Download FFMPEG Archive
+	Debugf("Downloading ffmpeg from: %s", url)
+	err = DownloadFileMD5(url, archivePath, checksum)
+	if err != nil {
+		return fmt.Errorf("Error downloading ffmpeg: %s", err)
+	}
+
+	// the release can change between reading the readme and downloading, trust the archive
+	root, archiveVersion, err := linuxFFMPEGArchiveRoot(archivePath)
+	if err != nil {
+		return fmt.Errorf("Error reading ffmpeg archive: %s", err)
+	}
+	if archiveVersion != version {
+		os.Remove(archivePath)
+		return fmt.Errorf("Requested ffmpeg %s but the archive contains %s, a new release was probably published, try again", version, archiveVersion)
+	}
+
+	Debug("Writing FFMPEG Version file...")
+	err = WriteVersionFile(dir, archiveVersion)
+	if err != nil {
+		return fmt.Errorf("Error writing ffmpeg version file: %s", err)
+	}
+
+	// Extract the FFMPEG Archive
+	Debugf("Extracting ffmpeg to %s...", dir)
+	err = ExtractArchive(archivePath, dir, ExtractOptions{
+		StripPrefix: root + "/",
+		Filters:     []string{"ffmpeg"},
+		Flatten:     true,
+	})
+	if err != nil {
+		return fmt.Errorf("Error extracting ffmpeg: %s", err)
+	}
+
+	// make sure we can run it even if the archive lost the permissions
+	err = os.Chmod(filepath.Join(dir, "ffmpeg"), 0755)
+	if err != nil {
+		return fmt.Errorf("Error making ffmpeg executable: %s", err)
+	}
+
+	return os.Remove(archivePath)
 }
 
 // Function to get the latest version of FFMPEG for current platform
-func GetLatestFFMPEGVersion() (string, error) {
+func (s FFMPEGSources) GetLatestFFMPEGVersion() (string, error) {
 	switch runtime.GOOS {
 	case "windows":
-		return GetLatestWinFFMPEGVersion()
+		return s.GetLatestWinFFMPEGVersion()
 	case "darwin":
-		return GetLatestMacFFMPEGVersion()
+		return s.GetLatestMacFFMPEGVersion()
 	case "linux":
-		return GetLatestLinuxFFMPEGVersion()
+		return s.GetLatestLinuxFFMPEGVersion()
 	}
 
 	return "", fmt.Errorf("Unsupported OS: %s", runtime.GOOS)
 }
 
 // Function to download the latest version of FFMPEG for current platform
-func DownloadFFMPEG(version, dir string) error {
+func (s FFMPEGSources) DownloadFFMPEG(version, dir string) error {
 	switch runtime.GOOS {
 	case "windows":
-		return DownloadFFMPEGWindows(version, dir)
+		return s.DownloadFFMPEGWindows(version, dir)
 	case "darwin":
-		return DownloadFFMPEGMac(version, dir)
+		return s.DownloadFFMPEGMac(version, dir)
 	case "linux":
-		return DownloadFFMPEGLinux(version, dir)
+		return s.DownloadFFMPEGLinux(version, dir)
 	}
 
 	return fmt.Errorf("Unsupported OS: %s", runtime.GOOS)
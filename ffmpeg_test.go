@@ -0,0 +1,329 @@
+package main
+
+import (
+	"archive/tar"
+	"bytes"
+	"crypto/md5"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/ulikunitz/xz"
+)
+
+// Builds a tar.xz that looks like a johnvansickle static build
+func staticFFMPEGArchive(t *testing.T, version string) []byte {
+	t.Helper()
+
+	buf := bytes.Buffer{}
+	xw, err := xz.NewWriter(&buf)
+	if err != nil {
+		t.Fatal(err)
+	}
+	tw := tar.NewWriter(xw)
+	root := fmt.Sprintf("ffmpeg-%s-amd64-static/", version)
+	tw.WriteHeader(&tar.Header{Name: root, Mode: 0755, Typeflag: tar.TypeDir})
+	for _, name := range []string{"ffmpeg", "ffprobe", "readme.txt"} {
+		content := "binary " + name
+		tw.WriteHeader(&tar.Header{Name: root + name, Mode: 0755, Size: int64(len(content)), Typeflag: tar.TypeReg})
+		tw.Write([]byte(content))
+	}
+	if err := tw.Close(); err != nil {
+		t.Fatal(err)
+	}
+	if err := xw.Close(); err != nil {
+		t.Fatal(err)
+	}
+	return buf.Bytes()
+}
+
+// Serves a johnvansickle release readme and archive with the MD5 checksum next to it, md5sum overrides the checksum
+func newLinuxFFMPEGServer(t *testing.T, readmeVersion, archiveVersion, md5sum string) (*httptest.Server, FFMPEGSources) {
+	t.Helper()
+
+	archive := staticFFMPEGArchive(t, archiveVersion)
+	if md5sum == "" {
+		sum := md5.Sum(archive)
+		md5sum = hex.EncodeToString(sum[:])
+	}
+	mux := http.NewServeMux()
+	mux.HandleFunc("/release-readme.txt", func(w http.ResponseWriter, r *http.Request) {
+		fmt.Fprintf(w, "\n              build: ffmpeg-%s-amd64-static.tar.xz\n            version: %s\n\n              gcc: 8.3.0\n", readmeVersion, readmeVersion)
+	})
+	mux.HandleFunc("/releases/", func(w http.ResponseWriter, r *http.Request) {
+		if strings.HasSuffix(r.URL.Path, ".md5") {
+			fmt.Fprintf(w, "%s  %s\n", md5sum, strings.TrimSuffix(path.Base(r.URL.Path), ".md5"))
+			return
+		}
+		w.Write(archive)
+	})
+	server := httptest.NewServer(mux)
+
+	sources := FFMPEGSources{
+		LinuxLatestVersionURL: server.URL + "/release-readme.txt",
+		LinuxURL:              server.URL + "/releases/ffmpeg-release-%s-static.tar.xz",
+	}
+	return server, sources
+}
+
+func TestDownloadFFMPEGLinux(t *testing.T) {
+	server, sources := newLinuxFFMPEGServer(t, "6.0", "6.0", "")
+	defer server.Close()
+
+	dir := t.TempDir()
+	err := sources.DownloadFFMPEGLinux("6.0", dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	version, err := ReadVersionFile(dir)
+	if err != nil || version != "6.0" {
+		t.Errorf("got version %q (%v), expected 6.0", version, err)
+	}
+
+	info, err := os.Stat(filepath.Join(dir, "ffmpeg"))
+	if err != nil || info.Mode().Perm()&0100 == 0 {
+		t.Errorf("ffmpeg isn't executable: %v %v", info, err)
+	}
+	// only the ffmpeg binary is extracted, not the whole archive, and the archive is removed
+	for _, name := range []string{"ffprobe", "readme.txt", "ffmpeg-6.0-amd64-static", "ffmpeg-release-static.tar.xz"} {
+		if FileExists(filepath.Join(dir, name)) {
+			t.Errorf("%s shouldn't have been extracted", name)
+		}
+	}
+}
+
+func TestDownloadFFMPEGLinuxRefusesOtherVersions(t *testing.T) {
+	server, sources := newLinuxFFMPEGServer(t, "6.0", "6.0", "")
+	defer server.Close()
+
+	dir := t.TempDir()
+	err := sources.DownloadFFMPEGLinux("5.1.2", dir)
+	if err == nil || !strings.Contains(err.Error(), "Only the latest ffmpeg release (6.0)") {
+		t.Fatalf("expected the pinned version to be refused, got %v", err)
+	}
+	if VersionFileExists(dir) || FileExists(filepath.Join(dir, "ffmpeg")) {
+		t.Error("nothing should have been installed")
+	}
+}
+
+func TestDownloadFFMPEGLinuxChecksumMismatch(t *testing.T) {
+	server, sources := newLinuxFFMPEGServer(t, "6.0", "6.0", strings.Repeat("0", 32))
+	defer server.Close()
+
+	dir := t.TempDir()
+	err := sources.DownloadFFMPEGLinux("6.0", dir)
+	if err == nil || !strings.Contains(err.Error(), "checksum mismatch") {
+		t.Fatalf("expected a checksum mismatch, got %v", err)
+	}
+	entries, _ := os.ReadDir(dir)
+	if len(entries) > 0 {
+		t.Errorf("nothing should be left behind, got %d files", len(entries))
+	}
+}
+
+func TestDownloadFFMPEGLinuxArchiveVersionMismatch(t *testing.T) {
+	// a new release was published between reading the readme and downloading
+	server, sources := newLinuxFFMPEGServer(t, "6.0", "6.1", "")
+	defer server.Close()
+
+	dir := t.TempDir()
+	err := sources.DownloadFFMPEGLinux("6.0", dir)
+	if err == nil || !strings.Contains(err.Error(), "the archive contains 6.1") {
+		t.Fatalf("expected a version mismatch error, got %v", err)
+	}
+	if VersionFileExists(dir) {
+		t.Error("the requested version shouldn't have been recorded")
+	}
+}
+
+// Loads a recorded evermeet.cx info document from testdata
+func loadEvermeetFixture(t *testing.T, name string) *FFMPEGMacVersion {
+	t.Helper()
+
+	data, err := os.ReadFile(filepath.Join("testdata", name))
+	if err != nil {
+		t.Fatal(err)
+	}
+	release := &FFMPEGMacVersion{}
+	if err := json.Unmarshal(data, release); err != nil {
+		t.Fatal(err)
+	}
+	return release
+}
+
+func TestMacFFMPEGArchive(t *testing.T) {
+	tests := []struct {
+		name   string
+		modify func(release *FFMPEGMacVersion)
+		url    string
+		ext    string
+		err    string
+	}{
+		{
+			name: "signed 7z",
+			url:  "https://evermeet.cx/ffmpeg/ffmpeg-6.0.7z",
+			ext:  ".7z",
+		},
+		{
+			name:   "unsigned 7z",
+			modify: func(release *FFMPEGMacVersion) { release.Download.SZ.Sig = "" },
+			url:    "https://evermeet.cx/ffmpeg/ffmpeg-6.0.zip",
+			ext:    ".zip",
+		},
+		{
+			name:   "zip only",
+			modify: func(release *FFMPEGMacVersion) { release.Download.SZ = FFMPEGMacVersionDownloadInfo{} },
+			url:    "https://evermeet.cx/ffmpeg/ffmpeg-6.0.zip",
+			ext:    ".zip",
+		},
+		{
+			name: "no signatures",
+			modify: func(release *FFMPEGMacVersion) {
+				release.Download.SZ.Sig = ""
+				release.Download.Zip.Sig = ""
+			},
+			err: "No signature published for ffmpeg 6.0",
+		},
+		{
+			name:   "no downloads",
+			modify: func(release *FFMPEGMacVersion) { release.Download = FFMPEGMacVersionDownload{} },
+			err:    "No download published for ffmpeg 6.0",
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			release := loadEvermeetFixture(t, "evermeet_6.0.json")
+			if test.modify != nil {
+				test.modify(release)
+			}
+
+			download, ext, err := release.archive()
+			if test.err != "" {
+				if err == nil || !strings.Contains(err.Error(), test.err) {
+					t.Fatalf("expected an error containing %q, got %v", test.err, err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			if download.Url != test.url || ext != test.ext || download.Sig != test.url+".sig" {
+				t.Errorf("got %+v %s", download, ext)
+			}
+		})
+	}
+}
+
+func TestMacInfoURLs(t *testing.T) {
+	intelOnly := FFMPEGSources{
+		MacInfoURLs:        map[string]string{"amd64": "intel-snapshot"},
+		MacVersionInfoURLs: map[string]string{"amd64": "intel-%s"},
+	}
+	native := FFMPEGSources{
+		MacInfoURLs:        map[string]string{"amd64": "intel-snapshot", "arm64": "arm-snapshot"},
+		MacVersionInfoURLs: map[string]string{"amd64": "intel-%s", "arm64": "arm-%s"},
+	}
+
+	tests := []struct {
+		name    string
+		sources FFMPEGSources
+		arch    string
+		urls    []string
+	}{
+		{"intel", intelOnly, "amd64", []string{"intel-snapshot", "intel-%s"}},
+		{"arm64 falls back to intel", intelOnly, "arm64", []string{"intel-snapshot", "intel-%s"}},
+		{"native arm64", native, "arm64", []string{"arm-snapshot", "arm-%s"}},
+		{"unsupported", intelOnly, "386", nil},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			infoURL, versionInfoURL, err := test.sources.macInfoURLs(test.arch)
+			if test.urls == nil {
+				if err == nil {
+					t.Errorf("expected %s to be unsupported", test.arch)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			if got := []string{infoURL, versionInfoURL}; !reflect.DeepEqual(got, test.urls) {
+				t.Errorf("got %v, expected %v", got, test.urls)
+			}
+		})
+	}
+}
+
+// Serves the evermeet.cx snapshot and 6.0 info documents, unsigned strips the signatures from 6.0
+func newMacFFMPEGServer(t *testing.T, unsigned bool) (*httptest.Server, FFMPEGSources, *[]string) {
+	t.Helper()
+
+	release := loadEvermeetFixture(t, "evermeet_6.0.json")
+	if unsigned {
+		release.Download.SZ.Sig = ""
+		release.Download.Zip.Sig = ""
+	}
+
+	requested := []string{}
+	mux := http.NewServeMux()
+	mux.HandleFunc("/info/ffmpeg/snapshot", func(w http.ResponseWriter, r *http.Request) {
+		requested = append(requested, r.URL.Path)
+		http.ServeFile(w, r, filepath.Join("testdata", "evermeet_snapshot.json"))
+	})
+	mux.HandleFunc("/info/ffmpeg/6.0", func(w http.ResponseWriter, r *http.Request) {
+		requested = append(requested, r.URL.Path)
+		json.NewEncoder(w).Encode(release)
+	})
+	server := httptest.NewServer(mux)
+
+	sources := FFMPEGSources{
+		MacInfoURLs:        map[string]string{"amd64": server.URL + "/info/ffmpeg/snapshot"},
+		MacVersionInfoURLs: map[string]string{"amd64": server.URL + "/info/ffmpeg/%s"},
+	}
+	return server, sources, &requested
+}
+
+func TestGetMacFFMPEGInfo(t *testing.T) {
+	server, sources, _ := newMacFFMPEGServer(t, false)
+	defer server.Close()
+
+	release, err := getMacFFMPEGInfo(sources.MacInfoURLs["amd64"])
+	if err != nil {
+		t.Fatal(err)
+	}
+	if release.Type != "snapshot" || release.Version != "N-111806-gf0b3eee0ae-tessus" || release.Download.SZ.Size != 24.82 {
+		t.Errorf("got %+v", release)
+	}
+}
+
+func TestDownloadFFMPEGMacRefusesUnsignedBuilds(t *testing.T) {
+	server, sources, requested := newMacFFMPEGServer(t, true)
+	defer server.Close()
+
+	// arm64 has no builds of its own and uses the intel ones
+	dir := t.TempDir()
+	err := sources.downloadFFMPEGMac("6.0", dir, "arm64")
+	if err == nil || !strings.Contains(err.Error(), "No signature published for ffmpeg 6.0") {
+		t.Fatalf("expected the unsigned build to be refused, got %v", err)
+	}
+
+	// the snapshot isn't 6.0, so the version is looked up on its own
+	if !reflect.DeepEqual(*requested, []string{"/info/ffmpeg/snapshot", "/info/ffmpeg/6.0"}) {
+		t.Errorf("got requests %v", *requested)
+	}
+	entries, _ := os.ReadDir(dir)
+	if len(entries) > 0 {
+		t.Errorf("nothing should have been downloaded, got %d files", len(entries))
+	}
+}
@@ -6,10 +6,11 @@ import (
 	"github.com/google/go-github/v43/github"
 )
 
-var client = github.NewClient(nil)
+// The client used unless a dependency is given another one, tests point theirs at a local server
+var githubClient = github.NewClient(httpClient)
 
-func GetRespository(owner, repo string) (*github.Repository, error) {
-	rep, _, err := client.Repositories.Get(context.Background(), owner, repo)
+func GetRespository(gh *github.Client, owner, repo string) (*github.Repository, error) {
+	rep, _, err := gh.Repositories.Get(context.Background(), owner, repo)
 	if err != nil {
 		return nil, err
 	}
@@ -17,8 +18,8 @@ func GetRespository(owner, repo string) (*github.Repository, error) {
 	return rep, nil
 }
 
-func GetLatestRelease(owner, repo string) (*github.RepositoryRelease, error) {
-	latestRelease, _, err := client.Repositories.GetLatestRelease(context.Background(), owner, repo)
+func GetLatestRelease(gh *github.Client, owner, repo string) (*github.RepositoryRelease, error) {
+	latestRelease, _, err := gh.Repositories.GetLatestRelease(context.Background(), owner, repo)
 	if err != nil {
 		return nil, err
 	}
@@ -26,9 +27,18 @@ func GetLatestRelease(owner, repo string) (*github.RepositoryRelease, error) {
 	return latestRelease, nil
 }
 
-func GetReleaseAssets(owner, repo string, id int64) ([]*github.ReleaseAsset, error) {
+func GetReleaseByTag(gh *github.Client, owner, repo, tag string) (*github.RepositoryRelease, error) {
+	release, _, err := gh.Repositories.GetReleaseByTag(context.Background(), owner, repo, tag)
+	if err != nil {
+		return nil, err
+	}
+
+	return release, nil
+}
+
+func GetReleaseAssets(gh *github.Client, owner, repo string, id int64) ([]*github.ReleaseAsset, error) {
 	opts := &github.ListOptions{PerPage: 100}
-	assets, _, err := client.Repositories.ListReleaseAssets(context.Background(), owner, repo, id, opts)
+	assets, _, err := gh.Repositories.ListReleaseAssets(context.Background(), owner, repo, id, opts)
 	if err != nil {
 		return nil, err
 	}
@@ -0,0 +1,47 @@
+package main
+
+import (
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"testing"
+
+	"github.com/google/go-github/v43/github"
+)
+
+// A GitHub client that talks to a local server instead of api.github.com
+func newTestGitHubClient(t *testing.T, server *httptest.Server) *github.Client {
+	t.Helper()
+
+	gh := github.NewClient(server.Client())
+	baseURL, err := url.Parse(server.URL + "/")
+	if err != nil {
+		t.Fatal(err)
+	}
+	gh.BaseURL = baseURL
+	return gh
+}
+
+func TestGetReleaseByTag(t *testing.T) {
+	mux := http.NewServeMux()
+	mux.HandleFunc("/repos/owner/repo/releases/tags/v1.0", func(w http.ResponseWriter, r *http.Request) {
+		fmt.Fprint(w, `{"id": 7, "tag_name": "v1.0"}`)
+	})
+	server := httptest.NewServer(mux)
+	defer server.Close()
+	gh := newTestGitHubClient(t, server)
+
+	release, err := GetReleaseByTag(gh, "owner", "repo", "v1.0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if release.GetID() != 7 || release.GetTagName() != "v1.0" {
+		t.Errorf("got release %d %s", release.GetID(), release.GetTagName())
+	}
+
+	_, err = GetReleaseByTag(gh, "owner", "repo", "v2.0")
+	if err == nil {
+		t.Error("a missing release should be an error")
+	}
+}
@@ -3,26 +3,26 @@ module github.com/udemy-dl-go
 go 1.18
 
 require (
+	github.com/fatih/color v1.13.0
 	github.com/google/go-github/v43 v43.0.0
 	github.com/k0kubun/go-ansi v0.0.0-20180517002512-3bf9e2903213
+	github.com/mattn/go-isatty v0.0.14
 	github.com/op/go-logging v0.0.0-20160315200505-970db520ece7
 	github.com/saracen/go7z v0.0.0-20191010121135-9c09b6bd7fda
 	github.com/schollz/progressbar/v3 v3.8.6
+	github.com/ulikunitz/xz v0.5.10
+	golang.org/x/crypto v0.0.0-20220315160706-3147a52a75dd
 )
 
 require (
-	github.com/fatih/color v1.13.0 // indirect
 	github.com/google/go-querystring v1.1.0 // indirect
 	github.com/mattn/go-colorable v0.1.9 // indirect
-	github.com/mattn/go-isatty v0.0.14 // indirect
 	github.com/mattn/go-runewidth v0.0.13 // indirect
 	github.com/mitchellh/colorstring v0.0.0-20190213212951-d06e56a500db // indirect
 	github.com/rivo/uniseg v0.2.0 // indirect
 	github.com/saracen/go7z-fixtures v0.0.0-20190623165746-aa6b8fba1d2f // indirect
 	github.com/saracen/solidblock v0.0.0-20190426153529-45df20abab6f // indirect
 	github.com/stretchr/testify v1.4.0 // indirect
-	github.com/ulikunitz/xz v0.5.10 // indirect
-	golang.org/x/crypto v0.0.0-20220315160706-3147a52a75dd // indirect
 	golang.org/x/sys v0.0.0-20220319134239-a9b59b0215f8 // indirect
 	golang.org/x/term v0.0.0-20210927222741-03fcf44c2211 // indirect
 	golang.org/x/tools v0.0.0-20200212150539-ea181f53ac56 // indirect
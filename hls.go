@@ -0,0 +1,589 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"crypto/aes"
+	"crypto/cipher"
+	"encoding/binary"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+
+	"github.com/schollz/progressbar/v3"
+)
+
+// Returned for playlists protected by a DRM key system, they can't be downloaded
+var ErrHLSDRM = errors.New("the stream is protected by DRM")
+
+// How many times a segment is downloaded before giving up, on top of the retries of the HTTP client
+const HLS_SEGMENT_ATTEMPTS = 3
+
+type HLSVariant struct {
+	URI       string
+	Bandwidth int
+	Width     int
+	Height    int
+	Codecs    string
+}
+
+type HLSKey struct {
+	// NONE or AES-128, anything else is DRM
+	Method    string
+	URI       string
+	IV        []byte
+	KeyFormat string
+}
+
+type HLSSegment struct {
+	URI      string
+	Duration float64
+	Sequence int64
+	Key      *HLSKey
+}
+
+type HLSPlaylist struct {
+	// a master playlist only has variants, a media playlist only has segments
+	Variants []HLSVariant
+	// InitSegment is the EXT-X-MAP of fragmented MP4 streams
+	InitSegment   string
+	Segments      []HLSSegment
+	MediaSequence int64
+	EndList       bool
+	// DRM is the key system or method that makes the stream unsupported
+	DRM string
+}
+
+func (p *HLSPlaylist) IsMaster() bool {
+	return len(p.Variants) > 0
+}
+
+// Parses an attribute list like BANDWIDTH=1280000,CODECS="avc1.4d401f,mp4a.40.2"
+func parseHLSAttributes(s string) map[string]string {
+	attributes := map[string]string{}
+	for len(s) > 0 {
+		eq := strings.IndexByte(s, '=')
+		if eq < 0 {
+			break
+		}
+		key := strings.TrimSpace(s[:eq])
+		s = s[eq+1:]
+
+		var value string
+		if strings.HasPrefix(s, "\"") {
+			end := strings.IndexByte(s[1:], '"')
+			if end < 0 {
+				value, s = s[1:], ""
+			} else {
+				value, s = s[1:end+1], s[end+2:]
+			}
+		} else if comma := strings.IndexByte(s, ','); comma >= 0 {
+			value, s = s[:comma], s[comma:]
+		} else {
+			value, s = s, ""
+		}
+		attributes[key] = value
+
+		s = strings.TrimPrefix(s, ",")
+	}
+	return attributes
+}
+
+// Key formats other than identity (widevine, fairplay, playready) and the SAMPLE-AES methods mean DRM
+func hlsKeyDRM(attributes map[string]string) string {
+	method := attributes["METHOD"]
+	format := attributes["KEYFORMAT"]
+	if format != "" && format != "identity" {
+		return format
+	}
+	if method != "" && method != "NONE" && method != "AES-128" {
+		return method
+	}
+	return ""
+}
+
+func resolveHLSURI(base *url.URL, uri string) string {
+	if base == nil {
+		return uri
+	}
+	ref, err := url.Parse(uri)
+	if err != nil {
+		return uri
+	}
+	return base.ResolveReference(ref).String()
+}
+
+// Parses a master or media playlist, URIs are resolved against base
+func ParseHLSPlaylist(data []byte, base *url.URL) (*HLSPlaylist, error) {
+	playlist := &HLSPlaylist{}
+	scanner := bufio.NewScanner(bytes.NewReader(data))
+	scanner.Buffer(make([]byte, 0, 64*1024), 1024*1024)
+
+	first := true
+	var key *HLSKey
+	var duration float64
+	var variant *HLSVariant
+	sequence := int64(-1)
+
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" {
+			continue
+		}
+		if first {
+			if line != "#EXTM3U" {
+				return nil, fmt.Errorf("not an HLS playlist")
+			}
+			first = false
+			continue
+		}
+
+		tag, value := line, ""
+		if colon := strings.IndexByte(line, ':'); colon >= 0 && strings.HasPrefix(line, "#") {
+			tag, value = line[:colon], line[colon+1:]
+		}
+
+		switch tag {
+		case "#EXT-X-STREAM-INF":
+			attributes := parseHLSAttributes(value)
+			variant = &HLSVariant{Codecs: attributes["CODECS"]}
+			variant.Bandwidth, _ = strconv.Atoi(attributes["BANDWIDTH"])
+			if resolution := strings.SplitN(attributes["RESOLUTION"], "x", 2); len(resolution) == 2 {
+				variant.Width, _ = strconv.Atoi(resolution[0])
+				variant.Height, _ = strconv.Atoi(resolution[1])
+			}
+		case "#EXT-X-SESSION-KEY":
+			if drm := hlsKeyDRM(parseHLSAttributes(value)); drm != "" {
+				playlist.DRM = drm
+			}
+		case "#EXT-X-KEY":
+			attributes := parseHLSAttributes(value)
+			if drm := hlsKeyDRM(attributes); drm != "" {
+				playlist.DRM = drm
+			}
+			if attributes["METHOD"] == "NONE" {
+				key = nil
+				continue
+			}
+			key = &HLSKey{
+				Method:    attributes["METHOD"],
+				URI:       resolveHLSURI(base, attributes["URI"]),
+				KeyFormat: attributes["KEYFORMAT"],
+			}
+			if iv := attributes["IV"]; iv != "" {
+				decoded, err := hex.DecodeString(strings.TrimPrefix(strings.TrimPrefix(iv, "0x"), "0X"))
+				if err != nil || len(decoded) != aes.BlockSize {
+					return nil, fmt.Errorf("invalid key IV %q", iv)
+				}
+				key.IV = decoded
+			}
+		case "#EXT-X-MAP":
+			playlist.InitSegment = resolveHLSURI(base, parseHLSAttributes(value)["URI"])
+		case "#EXT-X-MEDIA-SEQUENCE":
+			n, err := strconv.ParseInt(value, 10, 64)
+			if err != nil {
+				return nil, fmt.Errorf("invalid media sequence %q", value)
+			}
+			playlist.MediaSequence = n
+		case "#EXTINF":
+			d, err := strconv.ParseFloat(strings.SplitN(value, ",", 2)[0], 64)
+			if err != nil {
+				return nil, fmt.Errorf("invalid segment duration %q", value)
+			}
+			duration = d
+		case "#EXT-X-BYTERANGE":
+			return nil, fmt.Errorf("byte range segments are not supported")
+		case "#EXT-X-ENDLIST":
+			playlist.EndList = true
+		default:
+			if strings.HasPrefix(line, "#") {
+				continue
+			}
+
+			// a URI line belongs to the tag before it
+			uri := resolveHLSURI(base, line)
+			if variant != nil {
+				variant.URI = uri
+				playlist.Variants = append(playlist.Variants, *variant)
+				variant = nil
+				continue
+			}
+
+			if sequence < 0 {
+				sequence = playlist.MediaSequence
+			}
+			playlist.Segments = append(playlist.Segments, HLSSegment{URI: uri, Duration: duration, Sequence: sequence, Key: key})
+			sequence++
+			duration = 0
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, err
+	}
+	if first {
+		return nil, fmt.Errorf("not an HLS playlist")
+	}
+
+	return playlist, nil
+}
+
+// Downloads HLS streams and remuxes them into MP4 files with FFMPEG
+type HLSDownloader struct {
+	Client *http.Client
+	// Concurrency is the number of segments downloaded at the same time
+	Concurrency int
+	FFmpegPath  string
+
+	keysMu sync.Mutex
+	keys   map[string][]byte
+}
+
+func NewHLSDownloader(ffmpegPath string) *HLSDownloader {
+	return &HLSDownloader{
+		Client:      httpClient,
+		Concurrency: 4,
+		FFmpegPath:  ffmpegPath,
+		keys:        map[string][]byte{},
+	}
+}
+
+// Gets and parses a playlist, DRM playlists are reported as ErrHLSDRM
+func (h *HLSDownloader) FetchPlaylist(ctx context.Context, playlistURL string) (*HLSPlaylist, error) {
+	base, err := url.Parse(playlistURL)
+	if err != nil {
+		return nil, err
+	}
+
+	data, err := GetBytesContext(ctx, h.Client, playlistURL)
+	if err != nil {
+		return nil, fmt.Errorf("Error getting playlist: %s", err)
+	}
+
+	playlist, err := ParseHLSPlaylist(data, base)
+	if err != nil {
+		return nil, fmt.Errorf("Error parsing playlist: %s", err)
+	}
+
+	if playlist.DRM != "" {
+		return nil, fmt.Errorf("%w (%s)", ErrHLSDRM, playlist.DRM)
+	}
+
+	return playlist, nil
+}
+
+// Picks the variant for a quality. Variants without a resolution (like audio only ones) are only used when none has one.
+func SelectHLSVariant(variants []HLSVariant, quality QualityPreference) (HLSVariant, bool) {
+	sorted := []HLSVariant{}
+	for _, v := range variants {
+		if v.Height > 0 {
+			sorted = append(sorted, v)
+		}
+	}
+	if len(sorted) == 0 {
+		sorted = append(sorted, variants...)
+	}
+	sort.SliceStable(sorted, func(i, j int) bool {
+		if sorted[i].Height != sorted[j].Height {
+			return sorted[i].Height > sorted[j].Height
+		}
+		return sorted[i].Bandwidth > sorted[j].Bandwidth
+	})
+
+	sources := make([]VideoSource, len(sorted))
+	for i, v := range sorted {
+		sources[i] = VideoSource{URL: v.URI, Height: v.Height}
+	}
+
+	source, ok := quality.Select(sources)
+	if !ok {
+		return HLSVariant{}, false
+	}
+	for _, v := range sorted {
+		if v.URI == source.URL {
+			return v, true
+		}
+	}
+	return HLSVariant{}, false
+}
+
+// Downloads a stream to dest as MP4, returns the height of the variant that was picked (0 when unknown).
+// Finished segments are kept in dest.hls until the remux succeeds so an interrupted download picks up where it stopped.
+func (h *HLSDownloader) Download(ctx context.Context, playlistURL, dest string, quality QualityPreference, newBar ProgressFactory) (int, error) {
+	if h.FFmpegPath == "" {
+		return 0, fmt.Errorf("FFMPEG is needed to download HLS streams")
+	}
+
+	playlist, err := h.FetchPlaylist(ctx, playlistURL)
+	if err != nil {
+		return 0, err
+	}
+
+	height := 0
+	if playlist.IsMaster() {
+		variant, ok := SelectHLSVariant(playlist.Variants, quality)
+		if !ok {
+			return 0, fmt.Errorf("no variants in the master playlist")
+		}
+		height = variant.Height
+		Debugf("Picked HLS variant %dx%d (%d bps)", variant.Width, variant.Height, variant.Bandwidth)
+
+		playlist, err = h.FetchPlaylist(ctx, variant.URI)
+		if err != nil {
+			return 0, err
+		}
+		if playlist.IsMaster() {
+			return 0, fmt.Errorf("the variant playlist is a master playlist too")
+		}
+	}
+
+	if len(playlist.Segments) == 0 {
+		return 0, fmt.Errorf("the playlist has no segments")
+	}
+
+	segmentDir := dest + ".hls"
+	err = EnsureDirExist(segmentDir)
+	if err != nil {
+		return 0, err
+	}
+
+	var bar *progressbar.ProgressBar
+	if newBar != nil {
+		bar = newBar(-1)
+	}
+
+	paths, err := h.downloadSegments(ctx, playlist, segmentDir, bar)
+	if err != nil {
+		return 0, err
+	}
+
+	err = h.remux(ctx, paths, segmentDir, dest)
+	if err != nil {
+		return 0, err
+	}
+
+	return height, os.RemoveAll(segmentDir)
+}
+
+// Downloads every segment into dir with a pool of workers, returns the files in playlist order
+func (h *HLSDownloader) downloadSegments(ctx context.Context, playlist *HLSPlaylist, dir string, bar *progressbar.ProgressBar) ([]string, error) {
+	type segmentJob struct {
+		uri     string
+		segment *HLSSegment
+		path    string
+	}
+
+	jobs := []segmentJob{}
+	ext := ".ts"
+	if playlist.InitSegment != "" {
+		ext = ".m4s"
+		jobs = append(jobs, segmentJob{uri: playlist.InitSegment, path: filepath.Join(dir, "init.mp4")})
+	}
+	for i := range playlist.Segments {
+		segment := &playlist.Segments[i]
+		jobs = append(jobs, segmentJob{uri: segment.URI, segment: segment, path: filepath.Join(dir, fmt.Sprintf("%05d%s", i, ext))})
+	}
+
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
+	queue := make(chan segmentJob)
+	errs := make(chan error, 1)
+	wg := sync.WaitGroup{}
+
+	concurrency := h.Concurrency
+	if concurrency < 1 {
+		concurrency = 1
+	}
+	for i := 0; i < concurrency; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for job := range queue {
+				err := h.downloadSegment(ctx, job.uri, job.segment, job.path, bar)
+				if err != nil {
+					select {
+					case errs <- fmt.Errorf("Error downloading segment %s: %s", filepath.Base(job.path), err):
+					default:
+					}
+					cancel()
+				}
+			}
+		}()
+	}
+
+produce:
+	for _, job := range jobs {
+		select {
+		case queue <- job:
+		case <-ctx.Done():
+			break produce
+		}
+	}
+	close(queue)
+	wg.Wait()
+
+	select {
+	case err := <-errs:
+		return nil, err
+	default:
+	}
+	if ctx.Err() != nil {
+		return nil, ctx.Err()
+	}
+
+	paths := make([]string, len(jobs))
+	for i, job := range jobs {
+		paths[i] = job.path
+	}
+	return paths, nil
+}
+
+// Downloads and decrypts a single segment, segments that are already there are skipped
+func (h *HLSDownloader) downloadSegment(ctx context.Context, uri string, segment *HLSSegment, path string, bar *progressbar.ProgressBar) error {
+	if FileExists(path) {
+		return nil
+	}
+
+	var data []byte
+	var err error
+	for attempt := 1; attempt <= HLS_SEGMENT_ATTEMPTS; attempt++ {
+		data, err = GetBytesContext(ctx, h.Client, uri)
+		if err == nil || ctx.Err() != nil {
+			break
+		}
+		Debugf("Segment %s failed (attempt %d of %d): %s", filepath.Base(path), attempt, HLS_SEGMENT_ATTEMPTS, err)
+	}
+	if err != nil {
+		return err
+	}
+
+	if segment != nil && segment.Key != nil {
+		data, err = h.decrypt(ctx, data, segment)
+		if err != nil {
+			return err
+		}
+	}
+
+	err = WriteFileAtomic(path, data)
+	if err != nil {
+		return err
+	}
+
+	if bar != nil {
+		bar.Add(len(data))
+	}
+	return nil
+}
+
+// Gets an AES-128 key, each key is only downloaded once
+func (h *HLSDownloader) key(ctx context.Context, uri string) ([]byte, error) {
+	h.keysMu.Lock()
+	defer h.keysMu.Unlock()
+
+	if h.keys == nil {
+		h.keys = map[string][]byte{}
+	}
+	if key, ok := h.keys[uri]; ok {
+		return key, nil
+	}
+
+	key, err := GetBytesContext(ctx, h.Client, uri)
+	if err != nil {
+		return nil, fmt.Errorf("Error getting key: %s", err)
+	}
+	if len(key) != 16 {
+		return nil, fmt.Errorf("invalid AES-128 key of %d bytes", len(key))
+	}
+
+	h.keys[uri] = key
+	return key, nil
+}
+
+// Decrypts an AES-128 segment, without an IV in the playlist the media sequence number is the IV
+func (h *HLSDownloader) decrypt(ctx context.Context, data []byte, segment *HLSSegment) ([]byte, error) {
+	if segment.Key.Method != "AES-128" {
+		return nil, fmt.Errorf("%w (%s)", ErrHLSDRM, segment.Key.Method)
+	}
+
+	key, err := h.key(ctx, segment.Key.URI)
+	if err != nil {
+		return nil, err
+	}
+
+	iv := segment.Key.IV
+	if iv == nil {
+		iv = make([]byte, aes.BlockSize)
+		binary.BigEndian.PutUint64(iv[8:], uint64(segment.Sequence))
+	}
+
+	if len(data) == 0 || len(data)%aes.BlockSize != 0 {
+		return nil, fmt.Errorf("encrypted segment size %d is not a multiple of the block size", len(data))
+	}
+
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, err
+	}
+	plain := make([]byte, len(data))
+	cipher.NewCBCDecrypter(block, iv).CryptBlocks(plain, data)
+
+	// remove the PKCS#7 padding
+	padding := int(plain[len(plain)-1])
+	if padding == 0 || padding > aes.BlockSize || padding > len(plain) {
+		return nil, fmt.Errorf("invalid padding, the key is probably wrong")
+	}
+	return plain[:len(plain)-padding], nil
+}
+
+// Concatenates the segments and remuxes them into an MP4 file with FFMPEG
+func (h *HLSDownloader) remux(ctx context.Context, paths []string, dir, dest string) error {
+	joined := filepath.Join(dir, "joined"+filepath.Ext(paths[len(paths)-1]))
+	out, err := os.Create(joined)
+	if err != nil {
+		return err
+	}
+
+	for _, p := range paths {
+		err = appendFile(out, p)
+		if err != nil {
+			out.Close()
+			return err
+		}
+	}
+	err = out.Close()
+	if err != nil {
+		return err
+	}
+
+	partPath := dest + ".part.mp4"
+	cmd := exec.CommandContext(ctx, h.FFmpegPath, "-y", "-loglevel", "error", "-i", joined, "-c", "copy", "-bsf:a", "aac_adtstoasc", partPath)
+	output, err := cmd.CombinedOutput()
+	if err != nil {
+		os.Remove(partPath)
+		return fmt.Errorf("Error remuxing with ffmpeg: %s: %s", err, strings.TrimSpace(string(output)))
+	}
+
+	return os.Rename(partPath, dest)
+}
+
+func appendFile(w io.Writer, path string) error {
+	f, err := os.Open(path)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	_, err = io.Copy(w, f)
+	return err
+}
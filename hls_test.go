@@ -0,0 +1,476 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"crypto/aes"
+	"crypto/cipher"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"os"
+	"path/filepath"
+	"reflect"
+	"runtime"
+	"strings"
+	"sync"
+	"testing"
+)
+
+var testHLSKey = []byte("0123456789abcdef")
+
+// Encrypts a segment like an HLS packager, a nil iv uses the sequence number
+func encryptHLSSegment(t *testing.T, key, iv []byte, sequence uint64, plain []byte) []byte {
+	t.Helper()
+
+	if iv == nil {
+		iv = make([]byte, aes.BlockSize)
+		binary.BigEndian.PutUint64(iv[8:], sequence)
+	}
+	padding := aes.BlockSize - len(plain)%aes.BlockSize
+	padded := append(append([]byte{}, plain...), bytes.Repeat([]byte{byte(padding)}, padding)...)
+
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	encrypted := make([]byte, len(padded))
+	cipher.NewCBCEncrypter(block, iv).CryptBlocks(encrypted, padded)
+	return encrypted
+}
+
+func mustParseURL(t *testing.T, raw string) *url.URL {
+	t.Helper()
+
+	u, err := url.Parse(raw)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return u
+}
+
+func TestParseHLSAttributes(t *testing.T) {
+	attributes := parseHLSAttributes(`BANDWIDTH=1280000,CODECS="avc1.4d401f,mp4a.40.2",RESOLUTION=1280x720,NAME="a=b",LAST=x`)
+	expected := map[string]string{
+		"BANDWIDTH":  "1280000",
+		"CODECS":     "avc1.4d401f,mp4a.40.2",
+		"RESOLUTION": "1280x720",
+		"NAME":       "a=b",
+		"LAST":       "x",
+	}
+	if !reflect.DeepEqual(attributes, expected) {
+		t.Errorf("got %v", attributes)
+	}
+}
+
+func TestParseHLSPlaylistMaster(t *testing.T) {
+	data := `#EXTM3U
+#EXT-X-VERSION:3
+#EXT-X-STREAM-INF:BANDWIDTH=800000,RESOLUTION=640x360,CODECS="avc1.4d401e,mp4a.40.2"
+360/index.m3u8
+
+#EXT-X-STREAM-INF:BANDWIDTH=2800000,RESOLUTION=1280x720,CODECS="avc1.4d401f,mp4a.40.2"
+https://cdn.example.com/720/index.m3u8
+#EXT-X-STREAM-INF:BANDWIDTH=64000,CODECS="mp4a.40.2"
+/audio/index.m3u8
+`
+	playlist, err := ParseHLSPlaylist([]byte(data), mustParseURL(t, "https://example.com/hls/master.m3u8?token=x"))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	expected := []HLSVariant{
+		{URI: "https://example.com/hls/360/index.m3u8", Bandwidth: 800000, Width: 640, Height: 360, Codecs: "avc1.4d401e,mp4a.40.2"},
+		{URI: "https://cdn.example.com/720/index.m3u8", Bandwidth: 2800000, Width: 1280, Height: 720, Codecs: "avc1.4d401f,mp4a.40.2"},
+		{URI: "https://example.com/audio/index.m3u8", Bandwidth: 64000, Codecs: "mp4a.40.2"},
+	}
+	if !playlist.IsMaster() || !reflect.DeepEqual(playlist.Variants, expected) {
+		t.Errorf("got %+v", playlist.Variants)
+	}
+	if len(playlist.Segments) != 0 || playlist.DRM != "" {
+		t.Errorf("unexpected segments or DRM in %+v", playlist)
+	}
+}
+
+func TestParseHLSPlaylistMedia(t *testing.T) {
+	data := `#EXTM3U
+#EXT-X-TARGETDURATION:10
+#EXT-X-MEDIA-SEQUENCE:41
+#EXT-X-MAP:URI="init.mp4"
+#EXT-X-KEY:METHOD=AES-128,URI="https://keys.example.com/k1",IV=0x000102030405060708090A0B0C0D0E0F
+#EXTINF:9.5,
+seg41.m4s
+#EXT-X-KEY:METHOD=AES-128,URI="k2",KEYFORMAT="identity"
+#EXTINF:10.0,title
+seg42.m4s
+#EXT-X-KEY:METHOD=NONE
+#EXTINF:4,
+seg43.m4s
+#EXT-X-ENDLIST
+`
+	playlist, err := ParseHLSPlaylist([]byte(data), mustParseURL(t, "https://example.com/hls/720/index.m3u8"))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if playlist.IsMaster() || !playlist.EndList || playlist.MediaSequence != 41 || playlist.DRM != "" {
+		t.Errorf("got %+v", playlist)
+	}
+	if playlist.InitSegment != "https://example.com/hls/720/init.mp4" {
+		t.Errorf("got init segment %q", playlist.InitSegment)
+	}
+
+	iv := []byte{0, 1, 2, 3, 4, 5, 6, 7, 8, 9, 10, 11, 12, 13, 14, 15}
+	expected := []HLSSegment{
+		{URI: "https://example.com/hls/720/seg41.m4s", Duration: 9.5, Sequence: 41, Key: &HLSKey{Method: "AES-128", URI: "https://keys.example.com/k1", IV: iv}},
+		{URI: "https://example.com/hls/720/seg42.m4s", Duration: 10, Sequence: 42, Key: &HLSKey{Method: "AES-128", URI: "https://example.com/hls/720/k2", KeyFormat: "identity"}},
+		{URI: "https://example.com/hls/720/seg43.m4s", Duration: 4, Sequence: 43},
+	}
+	if !reflect.DeepEqual(playlist.Segments, expected) {
+		for _, segment := range playlist.Segments {
+			t.Logf("%+v %+v", segment, segment.Key)
+		}
+		t.Error("unexpected segments")
+	}
+}
+
+func TestParseHLSPlaylistDRM(t *testing.T) {
+	tests := []struct {
+		name string
+		tag  string
+		drm  string
+	}{
+		{"widevine", `#EXT-X-KEY:METHOD=SAMPLE-AES-CTR,URI="data:text/plain;base64,AAAA",KEYFORMAT="urn:uuid:edef8ba9-79d6-4ace-a3c8-27dcd51d21ed"`, "urn:uuid:edef8ba9-79d6-4ace-a3c8-27dcd51d21ed"},
+		{"fairplay", `#EXT-X-KEY:METHOD=SAMPLE-AES,URI="skd://key",KEYFORMAT="com.apple.streamingkeydelivery"`, "com.apple.streamingkeydelivery"},
+		{"sample-aes", `#EXT-X-KEY:METHOD=SAMPLE-AES,URI="key"`, "SAMPLE-AES"},
+		{"session key", `#EXT-X-SESSION-KEY:METHOD=SAMPLE-AES,URI="skd://key",KEYFORMAT="com.apple.streamingkeydelivery"`, "com.apple.streamingkeydelivery"},
+		{"aes-128", `#EXT-X-KEY:METHOD=AES-128,URI="key"`, ""},
+		{"aes-128 identity", `#EXT-X-KEY:METHOD=AES-128,URI="key",KEYFORMAT="identity"`, ""},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			data := "#EXTM3U\n" + test.tag + "\n#EXTINF:10,\nseg0.ts\n#EXT-X-ENDLIST\n"
+			playlist, err := ParseHLSPlaylist([]byte(data), nil)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if playlist.DRM != test.drm {
+				t.Errorf("got DRM %q, expected %q", playlist.DRM, test.drm)
+			}
+		})
+	}
+}
+
+func TestParseHLSPlaylistInvalid(t *testing.T) {
+	tests := []struct {
+		name string
+		data string
+		err  string
+	}{
+		{"empty", "", "not an HLS playlist"},
+		{"html", "<html></html>", "not an HLS playlist"},
+		{"byte range", "#EXTM3U\n#EXTINF:10,\n#EXT-X-BYTERANGE:1000@0\nall.ts\n", "byte range"},
+		{"short IV", "#EXTM3U\n#EXT-X-KEY:METHOD=AES-128,URI=\"k\",IV=0x0102\n", "invalid key IV"},
+		{"duration", "#EXTM3U\n#EXTINF:ten,\nseg.ts\n", "invalid segment duration"},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			_, err := ParseHLSPlaylist([]byte(test.data), nil)
+			if err == nil || !strings.Contains(err.Error(), test.err) {
+				t.Errorf("expected an error containing %q, got %v", test.err, err)
+			}
+		})
+	}
+}
+
+func TestSelectHLSVariant(t *testing.T) {
+	variants := []HLSVariant{
+		{URI: "360", Height: 360, Bandwidth: 800000},
+		{URI: "1080", Height: 1080, Bandwidth: 5000000},
+		{URI: "audio", Bandwidth: 64000},
+		{URI: "720-low", Height: 720, Bandwidth: 1800000},
+		{URI: "720", Height: 720, Bandwidth: 2800000},
+	}
+
+	tests := []struct {
+		quality  QualityPreference
+		expected string
+	}{
+		{QualityPreference{Mode: QualityBest}, "1080"},
+		// the audio only variant is never picked for a video
+		{QualityPreference{Mode: QualityWorst}, "360"},
+		{QualityPreference{Mode: QualityExact, Height: 720}, "720"},
+		{QualityPreference{Mode: QualityExact, Height: 480}, "360"},
+		{QualityPreference{Mode: QualityAtMost, Height: 1080}, "1080"},
+		{QualityPreference{Mode: QualityAtMost, Height: 240}, "360"},
+	}
+
+	for _, test := range tests {
+		t.Run(test.quality.String(), func(t *testing.T) {
+			variant, ok := SelectHLSVariant(variants, test.quality)
+			if !ok || variant.URI != test.expected {
+				t.Errorf("got %q (%v), expected %q", variant.URI, ok, test.expected)
+			}
+		})
+	}
+
+	// {1080, 720, audio} with 480 falls back to the closest higher height
+	variant, _ := SelectHLSVariant([]HLSVariant{{URI: "1080", Height: 1080}, {URI: "720", Height: 720}, {URI: "audio"}}, QualityPreference{Mode: QualityExact, Height: 480})
+	if variant.URI != "720" {
+		t.Errorf("got %q, expected 720", variant.URI)
+	}
+
+	// without any resolutions the highest bandwidth is the best
+	variant, _ = SelectHLSVariant([]HLSVariant{{URI: "low", Bandwidth: 500000}, {URI: "high", Bandwidth: 2000000}}, QualityPreference{Mode: QualityBest})
+	if variant.URI != "high" {
+		t.Errorf("got %q, expected high", variant.URI)
+	}
+
+	if _, ok := SelectHLSVariant(nil, QualityPreference{}); ok {
+		t.Error("no variants shouldn't select anything")
+	}
+}
+
+func TestHLSDecrypt(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write(testHLSKey)
+	}))
+	defer server.Close()
+
+	iv := []byte("fedcba9876543210")
+	plain := []byte("a segment that isn't a multiple of the block size")
+
+	tests := []struct {
+		name      string
+		key       *HLSKey
+		encrypted []byte
+	}{
+		{"explicit IV", &HLSKey{Method: "AES-128", URI: server.URL, IV: iv}, encryptHLSSegment(t, testHLSKey, iv, 0, plain)},
+		{"sequence IV", &HLSKey{Method: "AES-128", URI: server.URL}, encryptHLSSegment(t, testHLSKey, nil, 1234, plain)},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			h := NewHLSDownloader("ffmpeg")
+			h.Client = server.Client()
+
+			decrypted, err := h.decrypt(context.Background(), test.encrypted, &HLSSegment{Sequence: 1234, Key: test.key})
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !bytes.Equal(decrypted, plain) {
+				t.Errorf("got %q", decrypted)
+			}
+		})
+	}
+
+	// a wrong key garbles the padding
+	h := NewHLSDownloader("ffmpeg")
+	h.Client = server.Client()
+	encrypted := encryptHLSSegment(t, []byte("another key 1234"), iv, 0, plain)
+	_, err := h.decrypt(context.Background(), encrypted, &HLSSegment{Key: &HLSKey{Method: "AES-128", URI: server.URL, IV: iv}})
+	if err == nil {
+		t.Error("decrypting with the wrong key should fail")
+	}
+
+	_, err = h.decrypt(context.Background(), encrypted, &HLSSegment{Key: &HLSKey{Method: "SAMPLE-AES", URI: server.URL}})
+	if !errors.Is(err, ErrHLSDRM) {
+		t.Errorf("expected SAMPLE-AES to be DRM, got %v", err)
+	}
+}
+
+// Counts the requests for each path and fails the first failures[path] of them
+type flakyHLSServer struct {
+	mu       sync.Mutex
+	requests map[string]int
+	failures map[string]int
+	files    map[string][]byte
+}
+
+func (s *flakyHLSServer) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	s.mu.Lock()
+	s.requests[r.URL.Path]++
+	count := s.requests[r.URL.Path]
+	s.mu.Unlock()
+
+	if count <= s.failures[r.URL.Path] {
+		w.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+	data, ok := s.files[r.URL.Path]
+	if !ok {
+		http.NotFound(w, r)
+		return
+	}
+	w.Write(data)
+}
+
+func TestHLSDownloadSegmentsRetries(t *testing.T) {
+	flaky := &flakyHLSServer{
+		requests: map[string]int{},
+		failures: map[string]int{"/init.mp4": 1, "/seg1.m4s": HLS_SEGMENT_ATTEMPTS - 1},
+		files: map[string][]byte{
+			"/init.mp4": []byte("init"),
+			"/seg0.m4s": []byte("zero"),
+			"/seg1.m4s": []byte("one"),
+			"/seg2.m4s": []byte("two"),
+		},
+	}
+	server := httptest.NewServer(flaky)
+	defer server.Close()
+
+	playlist := &HLSPlaylist{
+		InitSegment: server.URL + "/init.mp4",
+		Segments: []HLSSegment{
+			{URI: server.URL + "/seg0.m4s"},
+			{URI: server.URL + "/seg1.m4s"},
+			{URI: server.URL + "/seg2.m4s"},
+		},
+	}
+
+	// the test server client has no retries of its own, so every attempt is one request
+	h := NewHLSDownloader("ffmpeg")
+	h.Client = server.Client()
+	dir := t.TempDir()
+	paths, err := h.downloadSegments(context.Background(), playlist, dir, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	expected := []string{"init.mp4", "00000.m4s", "00001.m4s", "00002.m4s"}
+	for i, name := range expected {
+		if paths[i] != filepath.Join(dir, name) {
+			t.Errorf("got path %s, expected %s", paths[i], name)
+		}
+	}
+	data, _ := os.ReadFile(filepath.Join(dir, "00001.m4s"))
+	if string(data) != "one" {
+		t.Errorf("got %q", data)
+	}
+	if flaky.requests["/seg1.m4s"] != HLS_SEGMENT_ATTEMPTS {
+		t.Errorf("segment 1 was requested %d times", flaky.requests["/seg1.m4s"])
+	}
+
+	// finished segments aren't downloaded again
+	_, err = h.downloadSegments(context.Background(), playlist, dir, nil)
+	if err != nil || flaky.requests["/seg0.m4s"] != 1 {
+		t.Errorf("segment 0 was requested %d times: %v", flaky.requests["/seg0.m4s"], err)
+	}
+}
+
+func TestHLSDownloadSegmentsGivesUp(t *testing.T) {
+	flaky := &flakyHLSServer{
+		requests: map[string]int{},
+		failures: map[string]int{"/seg1.ts": HLS_SEGMENT_ATTEMPTS},
+		files: map[string][]byte{
+			"/seg0.ts": []byte("zero"),
+			"/seg1.ts": []byte("one"),
+		},
+	}
+	server := httptest.NewServer(flaky)
+	defer server.Close()
+
+	playlist := &HLSPlaylist{Segments: []HLSSegment{{URI: server.URL + "/seg0.ts"}, {URI: server.URL + "/seg1.ts"}}}
+
+	h := NewHLSDownloader("ffmpeg")
+	h.Client = server.Client()
+	dir := t.TempDir()
+	_, err := h.downloadSegments(context.Background(), playlist, dir, nil)
+	if err == nil || !strings.Contains(err.Error(), "segment 00001.ts") {
+		t.Fatalf("expected segment 1 to fail, got %v", err)
+	}
+	if flaky.requests["/seg1.ts"] != HLS_SEGMENT_ATTEMPTS {
+		t.Errorf("segment 1 was requested %d times", flaky.requests["/seg1.ts"])
+	}
+	if FileExists(filepath.Join(dir, "00001.ts")) {
+		t.Error("a failed segment shouldn't be written")
+	}
+}
+
+func TestHLSDownload(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("the fake ffmpeg is a shell script")
+	}
+
+	mux := http.NewServeMux()
+	mux.HandleFunc("/master.m3u8", func(w http.ResponseWriter, r *http.Request) {
+		fmt.Fprint(w, "#EXTM3U\n#EXT-X-STREAM-INF:BANDWIDTH=800000,RESOLUTION=640x360\nlow/index.m3u8\n#EXT-X-STREAM-INF:BANDWIDTH=2800000,RESOLUTION=1280x720\nhigh/index.m3u8\n")
+	})
+	mux.HandleFunc("/low/index.m3u8", func(w http.ResponseWriter, r *http.Request) {
+		fmt.Fprint(w, "#EXTM3U\n#EXT-X-MEDIA-SEQUENCE:7\n#EXT-X-KEY:METHOD=AES-128,URI=\"/key\"\n#EXTINF:10,\ns0.ts\n#EXTINF:10,\ns1.ts\n#EXT-X-KEY:METHOD=NONE\n#EXTINF:5,\ns2.ts\n#EXT-X-ENDLIST\n")
+	})
+	mux.HandleFunc("/key", func(w http.ResponseWriter, r *http.Request) {
+		w.Write(testHLSKey)
+	})
+	mux.HandleFunc("/low/s0.ts", func(w http.ResponseWriter, r *http.Request) {
+		w.Write(encryptHLSSegment(t, testHLSKey, nil, 7, []byte("AAAA")))
+	})
+	mux.HandleFunc("/low/s1.ts", func(w http.ResponseWriter, r *http.Request) {
+		w.Write(encryptHLSSegment(t, testHLSKey, nil, 8, []byte("BBBBBBBBBBBBBBBBBBBB")))
+	})
+	mux.HandleFunc("/low/s2.ts", func(w http.ResponseWriter, r *http.Request) {
+		fmt.Fprint(w, "CC")
+	})
+	mux.HandleFunc("/drm.m3u8", func(w http.ResponseWriter, r *http.Request) {
+		fmt.Fprint(w, "#EXTM3U\n#EXT-X-KEY:METHOD=SAMPLE-AES,URI=\"skd://key\",KEYFORMAT=\"com.apple.streamingkeydelivery\"\n#EXTINF:10,\na.ts\n")
+	})
+	server := httptest.NewServer(mux)
+	defer server.Close()
+
+	// copies the joined segments (the -i argument) to the output instead of remuxing them
+	dir := t.TempDir()
+	ffmpeg := filepath.Join(dir, "ffmpeg")
+	err := os.WriteFile(ffmpeg, []byte("#!/bin/sh\nfor a; do last=$a; done\ncp \"$5\" \"$last\"\n"), 0755)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	h := NewHLSDownloader(ffmpeg)
+	h.Client = server.Client()
+	dest := filepath.Join(dir, "lecture.mp4")
+	height, err := h.Download(context.Background(), server.URL+"/master.m3u8", dest, QualityPreference{Mode: QualityExact, Height: 480}, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if height != 360 {
+		t.Errorf("got height %d, expected 360", height)
+	}
+
+	data, _ := os.ReadFile(dest)
+	if string(data) != "AAAABBBBBBBBBBBBBBBBBBBBCC" {
+		t.Errorf("got %q", data)
+	}
+	if FileExists(dest + ".hls") {
+		t.Error("the segments should have been removed")
+	}
+
+	_, err = h.Download(context.Background(), server.URL+"/drm.m3u8", filepath.Join(dir, "drm.mp4"), QualityPreference{}, nil)
+	if !errors.Is(err, ErrHLSDRM) || !strings.Contains(err.Error(), "streamingkeydelivery") {
+		t.Errorf("expected ErrHLSDRM, got %v", err)
+	}
+}
+
+func TestHLSPlaylistURL(t *testing.T) {
+	tests := []struct {
+		name     string
+		video    VideoAsset
+		expected string
+	}{
+		{"stream url", VideoAsset{StreamURLs: []UdemyDownloadURL{{Type: "video/mp4", File: "https://x/a.mp4"}, {Type: "application/x-mpegURL", File: "https://x/a"}}}, "https://x/a"},
+		{"by extension", VideoAsset{StreamURLs: []UdemyDownloadURL{{File: "https://x/b.M3U8?token=1"}}}, "https://x/b.M3U8?token=1"},
+		{"none", VideoAsset{StreamURLs: []UdemyDownloadURL{{Type: "video/mp4", File: "https://x/a.mp4"}}}, ""},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			if got := test.video.HLSPlaylistURL(); got != test.expected {
+				t.Errorf("got %q, expected %q", got, test.expected)
+			}
+		})
+	}
+}
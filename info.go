@@ -0,0 +1,213 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"sort"
+	"strings"
+)
+
+// Rough video bitrates in bits per second used to estimate download sizes, the API doesn't tell us the file sizes
+var estimatedBitrates = map[int]int64{
+	144:  150_000,
+	360:  500_000,
+	480:  900_000,
+	720:  1_800_000,
+	1080: 3_500_000,
+	1440: 6_000_000,
+	2160: 12_000_000,
+}
+
+type CourseOutline struct {
+	ID            int              `json:"id"`
+	Title         string           `json:"title"`
+	Slug          string           `json:"slug"`
+	PortalName    string           `json:"portal_name"`
+	Chapters      []ChapterOutline `json:"chapters"`
+	LectureCount  int              `json:"lecture_count"`
+	TotalDuration int              `json:"total_duration"`
+	EstimatedSize int64            `json:"estimated_size"`
+	// DRM protected videos are skipped, they aren't part of the estimated size
+	DRMLectureCount int `json:"drm_lecture_count"`
+	DRMDuration     int `json:"drm_duration"`
+}
+
+type ChapterOutline struct {
+	Number   int              `json:"number"`
+	ID       int              `json:"id"`
+	Title    string           `json:"title"`
+	Lectures []LectureOutline `json:"lectures"`
+}
+
+type LectureOutline struct {
+	Number             int       `json:"number"`
+	ID                 int       `json:"id"`
+	Title              string    `json:"title"`
+	Type               AssetType `json:"type"`
+	DRM                bool      `json:"drm"`
+	Duration           int       `json:"duration"`
+	Qualities          []int     `json:"qualities"`
+	Captions           []string  `json:"captions"`
+	SupplementaryFiles int       `json:"supplementary_files"`
+	EstimatedSize      int64     `json:"estimated_size"`
+}
+
+// Collects the information shown by -info
+func BuildCourseOutline(course *Course) *CourseOutline {
+	outline := &CourseOutline{
+		ID:         course.ID,
+		Title:      course.Title,
+		Slug:       course.Slug,
+		PortalName: course.PortalName,
+		Chapters:   []ChapterOutline{},
+	}
+
+	lectureNumber := 0
+	for i, chapter := range course.Chapters {
+		chapterOutline := ChapterOutline{
+			Number:   i + 1,
+			ID:       chapter.ID,
+			Title:    chapter.Title,
+			Lectures: []LectureOutline{},
+		}
+
+		for _, lecture := range chapter.Lectures {
+			lectureNumber++
+			lectureOutline := LectureOutline{
+				Number:             lectureNumber,
+				ID:                 lecture.ID,
+				Title:              lecture.Title,
+				Qualities:          []int{},
+				Captions:           []string{},
+				SupplementaryFiles: len(lecture.SupplementaryAssets),
+			}
+
+			if asset := lecture.Asset; asset != nil {
+				lectureOutline.Type = asset.Type
+				if asset.Video != nil {
+					lectureOutline.Duration = asset.TimeEstimation
+					lectureOutline.Qualities = asset.Video.Qualities()
+					for _, caption := range asset.Video.Captions {
+						lectureOutline.Captions = append(lectureOutline.Captions, CaptionLanguage(caption))
+					}
+					lectureOutline.DRM = asset.Video.IsDRM()
+					if lectureOutline.DRM {
+						outline.DRMLectureCount++
+						outline.DRMDuration += asset.TimeEstimation
+					} else if len(lectureOutline.Qualities) > 0 {
+						lectureOutline.EstimatedSize = EstimateVideoSize(asset.TimeEstimation, lectureOutline.Qualities[0])
+					}
+				}
+			}
+
+			outline.TotalDuration += lectureOutline.Duration
+			outline.EstimatedSize += lectureOutline.EstimatedSize
+			chapterOutline.Lectures = append(chapterOutline.Lectures, lectureOutline)
+		}
+
+		outline.Chapters = append(outline.Chapters, chapterOutline)
+	}
+	outline.LectureCount = lectureNumber
+
+	return outline
+}
+
+// Estimates the size of a video from its duration and height
+func EstimateVideoSize(duration, height int) int64 {
+	heights := []int{}
+	for h := range estimatedBitrates {
+		heights = append(heights, h)
+	}
+	sort.Ints(heights)
+
+	// use the closest known height that isn't bigger
+	bitrate := estimatedBitrates[heights[0]]
+	for _, h := range heights {
+		if h <= height {
+			bitrate = estimatedBitrates[h]
+		}
+	}
+
+	return int64(duration) * bitrate / 8
+}
+
+// The heights of the video qualities the downloader can use, highest first
+func (v *VideoAsset) Qualities() []int {
+	qualities := []int{}
+	for _, source := range v.Sources() {
+		qualities = append(qualities, source.Height)
+	}
+	return qualities
+}
+
+func PrintCourseOutline(w io.Writer, outline *CourseOutline) {
+	fmt.Fprintf(w, "%s (%d)\n", outline.Title, outline.ID)
+	fmt.Fprintf(w, "%d chapters, %d lectures, %s of video, ~%s estimated\n", len(outline.Chapters), outline.LectureCount, FormatDuration(outline.TotalDuration), FormatBytes(outline.EstimatedSize))
+	if outline.DRMLectureCount > 0 {
+		percentage := 0
+		if outline.TotalDuration > 0 {
+			percentage = outline.DRMDuration * 100 / outline.TotalDuration
+		}
+		fmt.Fprintf(w, "%d lectures (%s, %d%% of the video) are DRM protected and will be skipped\n", outline.DRMLectureCount, FormatDuration(outline.DRMDuration), percentage)
+	}
+	fmt.Fprintln(w)
+
+	for _, chapter := range outline.Chapters {
+		fmt.Fprintf(w, "%02d. %s\n", chapter.Number, chapter.Title)
+
+		for _, lecture := range chapter.Lectures {
+			details := []string{string(lecture.Type)}
+			if lecture.Type == "" {
+				details = []string{"No asset"}
+			}
+			if lecture.Duration > 0 {
+				details = append(details, FormatDuration(lecture.Duration))
+			}
+			if lecture.DRM {
+				details = append(details, "DRM")
+			}
+			if len(lecture.Qualities) > 0 {
+				qualities := []string{}
+				for _, q := range lecture.Qualities {
+					qualities = append(qualities, fmt.Sprintf("%dp", q))
+				}
+				details = append(details, strings.Join(qualities, "/"))
+			}
+			if len(lecture.Captions) > 0 {
+				details = append(details, "captions: "+strings.Join(lecture.Captions, ","))
+			}
+			if lecture.SupplementaryFiles > 0 {
+				details = append(details, fmt.Sprintf("%d supplementary", lecture.SupplementaryFiles))
+			}
+
+			fmt.Fprintf(w, "    %03d. %s [%s]\n", lecture.Number, lecture.Title, strings.Join(details, ", "))
+		}
+	}
+}
+
+func PrintCourseOutlineJSON(w io.Writer, outline *CourseOutline) error {
+	encoder := json.NewEncoder(w)
+	encoder.SetIndent("", "  ")
+	return encoder.Encode(outline)
+}
+
+// Formats seconds as HH:MM:SS
+func FormatDuration(seconds int) string {
+	return fmt.Sprintf("%02d:%02d:%02d", seconds/3600, seconds%3600/60, seconds%60)
+}
+
+func FormatBytes(bytes int64) string {
+	const unit = 1024
+	if bytes < unit {
+		return fmt.Sprintf("%d B", bytes)
+	}
+
+	div, exp := int64(unit), 0
+	for n := bytes / unit; n >= unit; n /= unit {
+		div *= unit
+		exp++
+	}
+
+	return fmt.Sprintf("%.1f %ciB", float64(bytes)/float64(div), "KMGTPE"[exp])
+}
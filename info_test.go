@@ -0,0 +1,94 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"flag"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+var updateGolden = flag.Bool("update", false, "rewrite the golden files in testdata")
+
+// Compares the output with testdata/<name>, go test -run TestCourseOutline -update rewrites it
+func checkGolden(t *testing.T, name string, output []byte) {
+	t.Helper()
+
+	path := filepath.Join("testdata", name)
+	if *updateGolden {
+		if err := os.WriteFile(path, output, 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	expected, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(output, expected) {
+		t.Errorf("output differs from %s:\n%s", path, output)
+	}
+}
+
+func TestCourseOutline(t *testing.T) {
+	outline := BuildCourseOutline(buildFixtureCourse(t))
+
+	text := bytes.Buffer{}
+	PrintCourseOutline(&text, outline)
+	checkGolden(t, "outline.txt", text.Bytes())
+
+	output := bytes.Buffer{}
+	if err := PrintCourseOutlineJSON(&output, outline); err != nil {
+		t.Fatal(err)
+	}
+	checkGolden(t, "outline.json", output.Bytes())
+
+	// the JSON output reads back into the same outline
+	decoded := &CourseOutline{}
+	if err := json.Unmarshal(output.Bytes(), decoded); err != nil {
+		t.Fatal(err)
+	}
+	if decoded.LectureCount != outline.LectureCount || len(decoded.Chapters) != len(outline.Chapters) || decoded.EstimatedSize != outline.EstimatedSize {
+		t.Errorf("unexpected decoded outline: %+v", decoded)
+	}
+}
+
+func TestEstimateVideoSize(t *testing.T) {
+	tests := []struct {
+		duration int
+		height   int
+		expected int64
+	}{
+		{60, 720, 60 * 1_800_000 / 8},
+		// heights between the known ones use the lower one
+		{60, 900, 60 * 1_800_000 / 8},
+		// heights below the lowest one use the lowest one
+		{60, 100, 60 * 150_000 / 8},
+		{0, 1080, 0},
+	}
+
+	for _, test := range tests {
+		if size := EstimateVideoSize(test.duration, test.height); size != test.expected {
+			t.Errorf("%ds at %dp: got %d, expected %d", test.duration, test.height, size, test.expected)
+		}
+	}
+}
+
+func TestFormatBytes(t *testing.T) {
+	tests := map[int64]string{
+		0:                  "0 B",
+		1023:               "1023 B",
+		1024:               "1.0 KiB",
+		1536:               "1.5 KiB",
+		5 * 1024 * 1024:    "5.0 MiB",
+		3 << 40:            "3.0 TiB",
+		1024*1024*1024 - 1: "1024.0 MiB",
+	}
+
+	for bytes, expected := range tests {
+		if formatted := FormatBytes(bytes); formatted != expected {
+			t.Errorf("%d: got %q, expected %q", bytes, formatted, expected)
+		}
+	}
+}
@@ -1,18 +1,39 @@
 package main
 
 import (
+	"encoding/json"
 	"fmt"
+	"io"
 	"os"
+	"sort"
+	"strings"
+	"sync"
 	"time"
 
 	"github.com/fatih/color"
+	"github.com/mattn/go-isatty"
 )
 
-type ColorFunction func(format string, a ...interface{}) string
+// Where log messages are written to, errors and warnings go to logErrWriter
+var logWriter io.Writer = os.Stdout
+var logErrWriter io.Writer = os.Stderr
+
+// Gets a copy of every message without colours, nil when there is no log file
+var logFile io.Writer
+
+// Messages below this level are dropped, -debug lowers it to DEBUG
+var logLevel = INFO
+
+// text or json, json writes one object per line to the console and the log file
+var logFormat = "text"
+
+var logMu sync.Mutex
 
 type LogLevel struct {
 	LevelName string
-	Function  ColorFunction
+	Color     color.Attribute
+	// Severity orders the levels, the level constants themselves aren't ordered
+	Severity int
 }
 
 const (
@@ -28,88 +49,270 @@ const (
 func GetLogLevel(level int) LogLevel {
 	switch level {
 	case SUCCESS:
-		return LogLevel{LevelName: "SUCCESS", Function: color.HiGreenString}
+		return LogLevel{LevelName: "SUCCESS", Color: color.FgHiGreen, Severity: 1}
 	case INFO:
-		return LogLevel{LevelName: "INFO", Function: color.HiWhiteString}
+		return LogLevel{LevelName: "INFO", Color: color.FgHiWhite, Severity: 1}
 	case ERROR:
-		return LogLevel{LevelName: "ERROR", Function: color.HiRedString}
+		return LogLevel{LevelName: "ERROR", Color: color.FgHiRed, Severity: 4}
 	case DEBUG:
-		return LogLevel{LevelName: "DEBUG", Function: color.HiBlueString}
+		return LogLevel{LevelName: "DEBUG", Color: color.FgHiBlue, Severity: 0}
 	case WARNING:
-		return LogLevel{LevelName: "WARNING", Function: color.HiYellowString}
+		return LogLevel{LevelName: "WARNING", Color: color.FgHiYellow, Severity: 3}
 	case NOTICE:
-		return LogLevel{LevelName: "NOTICE", Function: color.HiCyanString}
+		return LogLevel{LevelName: "NOTICE", Color: color.FgHiCyan, Severity: 2}
 	case CRITICAL:
-		return LogLevel{LevelName: "CRITICAL", Function: color.RedString}
+		return LogLevel{LevelName: "CRITICAL", Color: color.FgRed, Severity: 5}
 	default:
-		return LogLevel{LevelName: "INFO", Function: color.HiWhiteString}
+		return LogLevel{LevelName: "INFO", Color: color.FgHiWhite, Severity: 1}
+	}
+}
+
+// Parses a -log-level value like "warning" into its level constant
+func ParseLogLevel(name string) (int, error) {
+	for level := SUCCESS; level <= CRITICAL; level++ {
+		if strings.EqualFold(GetLogLevel(level).LevelName, name) {
+			return level, nil
+		}
+	}
+	return INFO, fmt.Errorf("Unknown log level: %s", name)
+}
+
+// Copies every message to a file, the file is never closed because Critical exits without returning
+func SetLogFile(path string) error {
+	f, err := os.OpenFile(path, os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0644)
+	if err != nil {
+		return err
+	}
+
+	logMu.Lock()
+	defer logMu.Unlock()
+	logFile = f
+	return nil
+}
+
+// Whether a message at this level is written, the log file gets the same messages as the console
+func LogEnabled(level int) bool {
+	minimum := logLevel
+	if debug {
+		minimum = DEBUG
+	}
+	return GetLogLevel(level).Severity >= GetLogLevel(minimum).Severity
+}
+
+// Colours are only used on terminals, cron and pipes get plain text
+func useColor(w io.Writer) bool {
+	if os.Getenv("NO_COLOR") != "" {
+		return false
+	}
+	return isTerminal(w)
+}
+
+// True for terminals that understand ANSI escape codes
+func isTerminal(w io.Writer) bool {
+	if os.Getenv("TERM") == "dumb" {
+		return false
+	}
+
+	f, ok := w.(*os.File)
+	if !ok {
+		return false
+	}
+	return isatty.IsTerminal(f.Fd()) || isatty.IsCygwinTerminal(f.Fd())
+}
+
+// Structured context attached to a message, like course_id, lecture_id, asset_type, bytes or duration
+type Fields map[string]interface{}
+
+// A set of fields to log messages with, the helpers mirror the package level ones
+type LogEntry struct {
+	fields Fields
+}
+
+func WithFields(fields Fields) *LogEntry {
+	return &LogEntry{fields: fields}
+}
+
+// Returns a new entry with both sets of fields, the new ones win
+func (e *LogEntry) WithFields(fields Fields) *LogEntry {
+	merged := Fields{}
+	for k, v := range e.fields {
+		merged[k] = v
+	}
+	for k, v := range fields {
+		merged[k] = v
+	}
+	return &LogEntry{fields: merged}
+}
+
+func (e *LogEntry) Successf(format string, args ...interface{}) {
+	writeLogFields(SUCCESS, fmt.Sprintf(format, args...), e.fields)
+}
+
+func (e *LogEntry) Infof(format string, args ...interface{}) {
+	writeLogFields(INFO, fmt.Sprintf(format, args...), e.fields)
+}
+
+func (e *LogEntry) Errorf(format string, args ...interface{}) {
+	writeLogFields(ERROR, fmt.Sprintf(format, args...), e.fields)
+}
+
+func (e *LogEntry) Debugf(format string, args ...interface{}) {
+	writeLogFields(DEBUG, fmt.Sprintf(format, args...), e.fields)
+}
+
+func (e *LogEntry) Warningf(format string, args ...interface{}) {
+	writeLogFields(WARNING, fmt.Sprintf(format, args...), e.fields)
+}
+
+func (e *LogEntry) Logf(level int, format string, args ...interface{}) {
+	writeLogFields(level, fmt.Sprintf(format, args...), e.fields)
+}
+
+// Durations are logged in seconds so they can be summed up
+func logFieldValue(v interface{}) interface{} {
+	if d, ok := v.(time.Duration); ok {
+		return d.Seconds()
+	}
+	return v
+}
+
+// Formats fields as " key=value" pairs sorted by key
+func formatLogFields(fields Fields) string {
+	keys := make([]string, 0, len(fields))
+	for k := range fields {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+
+	b := strings.Builder{}
+	for _, k := range keys {
+		fmt.Fprintf(&b, " %s=%v", k, logFieldValue(fields[k]))
+	}
+	return b.String()
+}
+
+// One JSON object per message, the fields sit next to timestamp, level and message
+func formatLogJSON(now time.Time, level string, message string, fields Fields) string {
+	entry := map[string]interface{}{}
+	for k, v := range fields {
+		entry[k] = logFieldValue(v)
+	}
+	entry["timestamp"] = now.Format(time.RFC3339Nano)
+	entry["level"] = level
+	entry["message"] = message
+
+	data, err := json.Marshal(entry)
+	if err != nil {
+		data, _ = json.Marshal(map[string]string{"timestamp": entry["timestamp"].(string), "level": level, "message": message})
+	}
+	return string(data)
+}
+
+func writeLog(level int, message string) {
+	writeLogFields(level, message, nil)
+}
+
+func writeLogFields(level int, message string, fields Fields) {
+	if !LogEnabled(level) {
+		return
+	}
+
+	loglevel := GetLogLevel(level)
+	now := time.Now()
+
+	w := logWriter
+	if level == ERROR || level == WARNING || level == CRITICAL {
+		w = logErrWriter
+	}
+
+	logMu.Lock()
+	defer logMu.Unlock()
+
+	if logFormat == "json" {
+		line := formatLogJSON(now, loglevel.LevelName, message, fields)
+		fmt.Fprintln(w, line)
+		if logFile != nil {
+			fmt.Fprintln(logFile, line)
+		}
+		return
+	}
+
+	text := message
+	if useColor(w) {
+		c := color.New(loglevel.Color)
+		c.EnableColor()
+		text = c.Sprint(message)
+	}
+	extra := formatLogFields(fields)
+	fmt.Fprintf(w, "%s %s ▶ %s%s\n", now.Format("03:04:05"), loglevel.LevelName, text, extra)
+
+	if logFile != nil {
+		fmt.Fprintf(logFile, "%s %s ▶ %s%s\n", now.Format("2006-01-02 15:04:05.000 -0700"), loglevel.LevelName, message, extra)
 	}
 }
 
 func Success(message string) {
-	fmt.Println(fmt.Sprintf("%s %s ▶ %s", time.Now().Format("03:04:05"), "SUCCESS", color.HiGreenString(message)))
+	writeLog(SUCCESS, message)
 }
 
 func Successf(format string, args ...interface{}) {
-	fmt.Println(fmt.Sprintf("%s %s ▶ %s", time.Now().Format("03:04:05"), "SUCCESS", color.HiGreenString(fmt.Sprintf(format, args...))))
+	writeLog(SUCCESS, fmt.Sprintf(format, args...))
 }
 
 func Info(message string) {
-	fmt.Println(fmt.Sprintf("%s %s ▶ %s", time.Now().Format("03:04:05"), "INFO", color.HiWhiteString(message)))
+	writeLog(INFO, message)
 }
 
 func Infof(format string, args ...interface{}) {
-	fmt.Println(fmt.Sprintf("%s %s ▶ %s", time.Now().Format("03:04:05"), "INFO", color.HiWhiteString(fmt.Sprintf(format, args...))))
+	writeLog(INFO, fmt.Sprintf(format, args...))
 }
 
 func Error(message string) {
-	fmt.Println(fmt.Errorf("%s %s ▶ %s", time.Now().Format("03:04:05"), "ERROR", color.HiRedString(message)))
+	writeLog(ERROR, message)
 }
 
 func Errorf(format string, args ...interface{}) {
-	fmt.Println(fmt.Errorf("%s %s ▶ %s", time.Now().Format("03:04:05"), "ERROR", color.HiRedString(fmt.Sprintf(format, args...))))
+	writeLog(ERROR, fmt.Sprintf(format, args...))
 }
 
 func Debug(message string) {
-	fmt.Println(fmt.Sprintf("%s %s ▶ %s", time.Now().Format("03:04:05"), "DEBUG", color.HiBlueString(message)))
+	writeLog(DEBUG, message)
 }
 
 func Debugf(format string, args ...interface{}) {
-	fmt.Println(fmt.Sprintf("%s %s ▶ %s", time.Now().Format("03:04:05"), "DEBUG", color.HiBlueString(fmt.Sprintf(format, args...))))
+	writeLog(DEBUG, fmt.Sprintf(format, args...))
 }
 
 func Warning(message string) {
-	fmt.Println(fmt.Sprintf("%s %s ▶ %s", time.Now().Format("03:04:05"), "WARNING", color.HiYellowString(message)))
+	writeLog(WARNING, message)
 }
 
 func Warningf(format string, args ...interface{}) {
-	fmt.Println(fmt.Sprintf("%s %s ▶ %s", time.Now().Format("03:04:05"), "WARNING", color.HiYellowString(fmt.Sprintf(format, args...))))
+	writeLog(WARNING, fmt.Sprintf(format, args...))
 }
 
 func Notice(message string) {
-	fmt.Println(fmt.Sprintf("%s %s ▶ %s", time.Now().Format("03:04:05"), "NOTICE", color.HiCyanString(message)))
+	writeLog(NOTICE, message)
 }
 
 func Noticef(format string, args ...interface{}) {
-	fmt.Println(fmt.Sprintf("%s %s ▶ %s", time.Now().Format("03:04:05"), "NOTICE", color.HiCyanString(fmt.Sprintf(format, args...))))
+	writeLog(NOTICE, fmt.Sprintf(format, args...))
 }
 
 func Critical(message string) {
-	fmt.Println(fmt.Sprintf("%s %s ▶ %s", time.Now().Format("03:04:05"), "CRITICAL", color.RedString(message)))
+	writeLog(CRITICAL, message)
 	os.Exit(1)
 }
 
 func Criticalf(format string, args ...interface{}) {
-	fmt.Println(fmt.Sprintf("%s %s ▶ %s", time.Now().Format("03:04:05"), "CRITICAL", color.RedString(fmt.Sprintf(format, args...))))
+	writeLog(CRITICAL, fmt.Sprintf(format, args...))
 	os.Exit(1)
 }
 
 func Log(level int, message string) {
-	loglevel := GetLogLevel(level)
-	fmt.Println(fmt.Sprintf("%s %s ▶ %s", time.Now().Format("03:04:05"), loglevel.LevelName, loglevel.Function(message)))
+	writeLog(level, message)
 }
 
 func Logf(level int, format string, args ...interface{}) {
-	loglevel := GetLogLevel(level)
-	fmt.Println(fmt.Sprintf("%s %s ▶ %s", time.Now().Format("03:04:05"), loglevel.LevelName, loglevel.Function(fmt.Sprintf(format, args...))))
+	writeLog(level, fmt.Sprintf(format, args...))
 }
@@ -0,0 +1,208 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"regexp"
+	"strings"
+	"testing"
+	"time"
+)
+
+// Sends the log to buffers for the rest of the test: console, error console and log file
+func captureLogs(t *testing.T, level int) (*bytes.Buffer, *bytes.Buffer, *bytes.Buffer) {
+	t.Helper()
+
+	oldWriter, oldErrWriter, oldFile := logWriter, logErrWriter, logFile
+	oldLevel, oldFormat, oldDebug := logLevel, logFormat, debug
+	t.Cleanup(func() {
+		logWriter, logErrWriter, logFile = oldWriter, oldErrWriter, oldFile
+		logLevel, logFormat, debug = oldLevel, oldFormat, oldDebug
+	})
+
+	stdout, stderr, file := &bytes.Buffer{}, &bytes.Buffer{}, &bytes.Buffer{}
+	logWriter, logErrWriter, logFile = stdout, stderr, file
+	logLevel, logFormat, debug = level, "text", false
+	return stdout, stderr, file
+}
+
+func TestLogEnabled(t *testing.T) {
+	captureLogs(t, INFO)
+
+	tests := []struct {
+		minimum int
+		enabled []int
+	}{
+		{DEBUG, []int{DEBUG, SUCCESS, INFO, NOTICE, WARNING, ERROR, CRITICAL}},
+		{INFO, []int{SUCCESS, INFO, NOTICE, WARNING, ERROR, CRITICAL}},
+		// success shares the severity of info
+		{SUCCESS, []int{SUCCESS, INFO, NOTICE, WARNING, ERROR, CRITICAL}},
+		{NOTICE, []int{NOTICE, WARNING, ERROR, CRITICAL}},
+		{WARNING, []int{WARNING, ERROR, CRITICAL}},
+		{ERROR, []int{ERROR, CRITICAL}},
+		{CRITICAL, []int{CRITICAL}},
+	}
+
+	for _, test := range tests {
+		t.Run(GetLogLevel(test.minimum).LevelName, func(t *testing.T) {
+			logLevel = test.minimum
+			enabled := map[int]bool{}
+			for _, level := range test.enabled {
+				enabled[level] = true
+			}
+
+			for level := SUCCESS; level <= CRITICAL; level++ {
+				if LogEnabled(level) != enabled[level] {
+					t.Errorf("%s: expected enabled to be %v", GetLogLevel(level).LevelName, enabled[level])
+				}
+			}
+		})
+	}
+
+	// -debug overrides the level
+	logLevel, debug = ERROR, true
+	if !LogEnabled(DEBUG) {
+		t.Error("-debug should enable debug messages")
+	}
+}
+
+func TestLogRouting(t *testing.T) {
+	stdout, stderr, file := captureLogs(t, DEBUG)
+
+	for level := SUCCESS; level <= CRITICAL; level++ {
+		Log(level, GetLogLevel(level).LevelName+" message")
+	}
+
+	// errors and warnings go to stderr, the log file gets everything
+	expectedStdout := []string{"SUCCESS", "INFO", "DEBUG", "NOTICE"}
+	expectedStderr := []string{"ERROR", "WARNING", "CRITICAL"}
+	expectedFile := []string{"SUCCESS", "INFO", "ERROR", "DEBUG", "WARNING", "NOTICE", "CRITICAL"}
+	for _, test := range []struct {
+		name     string
+		output   *bytes.Buffer
+		expected []string
+	}{{"stdout", stdout, expectedStdout}, {"stderr", stderr, expectedStderr}, {"log file", file, expectedFile}} {
+		lines := strings.Split(strings.TrimSuffix(test.output.String(), "\n"), "\n")
+		if len(lines) != len(test.expected) {
+			t.Errorf("%s: got %q, expected %d lines", test.name, lines, len(test.expected))
+			continue
+		}
+		for i, name := range test.expected {
+			if !strings.Contains(lines[i], " "+name+" ▶ "+name+" message") {
+				t.Errorf("%s: got %q, expected a %s message", test.name, lines[i], name)
+			}
+		}
+	}
+}
+
+func TestLogFiltering(t *testing.T) {
+	stdout, stderr, file := captureLogs(t, WARNING)
+
+	Info("hidden")
+	Debug("hidden")
+	Notice("hidden")
+	Warning("shown")
+
+	if stdout.Len() != 0 || strings.Contains(file.String(), "hidden") {
+		t.Errorf("messages below the level were written: %q %q", stdout, file)
+	}
+	if !strings.Contains(stderr.String(), "shown") || !strings.Contains(file.String(), "shown") {
+		t.Errorf("the warning wasn't written: %q %q", stderr, file)
+	}
+}
+
+func TestLogLineFormat(t *testing.T) {
+	stdout, _, file := captureLogs(t, INFO)
+
+	WithFields(Fields{"lecture_id": 7, "course_id": 42, "duration": 1500 * time.Millisecond}).Infof("Downloaded %s", "video.mp4")
+
+	// the console gets the time, the log file the full date with milliseconds and time zone, both without colours
+	console := regexp.MustCompile(`^\d{2}:\d{2}:\d{2} INFO ▶ Downloaded video\.mp4 course_id=42 duration=1\.5 lecture_id=7\n$`)
+	if !console.MatchString(stdout.String()) {
+		t.Errorf("unexpected console line %q", stdout)
+	}
+	logLine := regexp.MustCompile(`^\d{4}-\d{2}-\d{2} \d{2}:\d{2}:\d{2}\.\d{3} [+-]\d{4} INFO ▶ Downloaded video\.mp4 course_id=42 duration=1\.5 lecture_id=7\n$`)
+	if !logLine.MatchString(file.String()) {
+		t.Errorf("unexpected log file line %q", file)
+	}
+}
+
+func TestParseLogLevel(t *testing.T) {
+	for _, name := range []string{"debug", "INFO", "Warning", "notice", "error", "critical", "success"} {
+		level, err := ParseLogLevel(name)
+		if err != nil || !strings.EqualFold(GetLogLevel(level).LevelName, name) {
+			t.Errorf("%s: got %d: %v", name, level, err)
+		}
+	}
+
+	if _, err := ParseLogLevel("verbose"); err == nil {
+		t.Error("expected an unknown level to be rejected")
+	}
+}
+
+func TestFormatLogJSON(t *testing.T) {
+	now := time.Date(2024, 3, 4, 5, 6, 7, 890000000, time.UTC)
+	line := formatLogJSON(now, "INFO", "Downloaded video.mp4", Fields{"course_id": 42, "asset_type": AssetTypeVideo, "duration": 2500 * time.Millisecond, "bytes": int64(1024)})
+
+	entry := map[string]interface{}{}
+	if err := json.Unmarshal([]byte(line), &entry); err != nil {
+		t.Fatalf("invalid JSON %q: %s", line, err)
+	}
+
+	// numbers decode as float64, durations are in seconds
+	expected := map[string]interface{}{
+		"timestamp":  "2024-03-04T05:06:07.89Z",
+		"level":      "INFO",
+		"message":    "Downloaded video.mp4",
+		"course_id":  float64(42),
+		"asset_type": "Video",
+		"duration":   2.5,
+		"bytes":      float64(1024),
+	}
+	if len(entry) != len(expected) {
+		t.Errorf("got %d keys, expected %d: %s", len(entry), len(expected), line)
+	}
+	for k, v := range expected {
+		if entry[k] != v {
+			t.Errorf("%s: got %v, expected %v", k, entry[k], v)
+		}
+	}
+	if strings.Contains(line, "\n") {
+		t.Errorf("expected a single line, got %q", line)
+	}
+}
+
+func TestFormatLogJSONReservedKeys(t *testing.T) {
+	now := time.Date(2024, 3, 4, 5, 6, 7, 0, time.UTC)
+
+	// fields can't replace the timestamp, level or message
+	line := formatLogJSON(now, "WARNING", "real message", Fields{"message": "fake", "level": "DEBUG", "timestamp": "never"})
+	if line != `{"level":"WARNING","message":"real message","timestamp":"2024-03-04T05:06:07Z"}` {
+		t.Errorf("unexpected line %s", line)
+	}
+
+	// fields that can't be encoded are dropped rather than losing the message
+	line = formatLogJSON(now, "ERROR", "still logged", Fields{"callback": func() {}})
+	if line != `{"level":"ERROR","message":"still logged","timestamp":"2024-03-04T05:06:07Z"}` {
+		t.Errorf("unexpected line %s", line)
+	}
+}
+
+func TestLogJSONFormat(t *testing.T) {
+	stdout, stderr, file := captureLogs(t, INFO)
+	logFormat = "json"
+
+	WithFields(Fields{"lecture_id": 7}).Infof("Downloaded %s", "video.mp4")
+	Warning("Slow down")
+
+	for _, output := range []*bytes.Buffer{stdout, stderr} {
+		entry := map[string]interface{}{}
+		if err := json.Unmarshal(output.Bytes(), &entry); err != nil {
+			t.Errorf("expected one JSON object, got %q: %s", output, err)
+		}
+	}
+	lines := strings.Split(strings.TrimSuffix(file.String(), "\n"), "\n")
+	if len(lines) != 2 || !strings.Contains(lines[0], `"lecture_id":7`) || !strings.Contains(lines[1], `"level":"WARNING"`) {
+		t.Errorf("unexpected log file %q", file)
+	}
+}
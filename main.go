@@ -1,85 +1,292 @@
 package main
 
 import (
+	"context"
+	"errors"
 	"flag"
+	"fmt"
 	"os"
+	"os/signal"
+	"syscall"
 )
 
 var version string = "DEVELOPMENT"
 var debug bool = false
 
 func main() {
-	// TODO: skip dependency check option
-	// TODO: get course information
-	// TODO: load from file argument
-	// TODO: save to file argument
-	// TODO: loading course information from file
-	// TODO: save course information to file
-	// TODO: get course content
-	// TODO: process course content (this should be 'on the fly', so instead of pre-processing, just start downloading and fetch information for the lectures as we go)
-	// TODO: info argument
 	// TODO: mkv support
 
 	if version == "DEVELOPMENT" {
 		debug = true
 	}
 
+	// subcommands have their own flags
+	if len(os.Args) > 1 && os.Args[1] == "update" {
+		RunUpdateCommand(os.Args[2:])
+		return
+	}
+
 	versionPtr := flag.Bool("version", false, "Print the program version")
 	// skipUpdatePtr := flag.Bool("skip-update", false, "Skip update check")
 	bearerPtr := flag.String("bearer", "", "Bearer token for authentication")
 	courseUrlPtr := flag.String("course", "", "Course URL")
 	debugPtr := flag.Bool("debug", false, "Enable debug logging")
+	logLevelPtr := flag.String("log-level", "info", "Minimum level of the messages to show: debug, info, notice, warning, error or critical")
+	logFilePtr := flag.String("log-file", "", "Also write the log to this file, without colours")
+	logFormatPtr := flag.String("log-format", "text", "Format of the log messages, text or json")
+	saveInfoPtr := flag.String("save-info", "", "Save the course information to a JSON file, it is saved again after downloading with the chosen qualities")
+	loadInfoPtr := flag.String("load-info", "", "Load the course information from a JSON file instead of the API")
+	infoPtr := flag.Bool("info", false, "Print the course outline without downloading anything")
+	infoFormatPtr := flag.String("info-format", "text", "Output format of -info, text or json")
+	outputPtr := flag.String("output", "out_dir", "Directory to download courses to")
+	qualityPtr := flag.String("quality", "best", "Video quality: best, worst, a height like 720 or a limit like <=1080. A missing height falls back to the closest lower one, or the closest higher one when there is none")
+	captionsPtr := flag.String("captions", "", "Caption languages to download like en,es or all, a language matches every locale of it")
+	captionFormatPtr := flag.String("captions-format", "srt", "Format to save captions in, srt or vtt")
+	articleMarkdownPtr := flag.Bool("article-markdown", false, "Also save article lectures as Markdown")
+	concurrencyPtr := flag.Int("concurrency", 2, "Number of lectures to download at the same time")
+	downloaderPtr := flag.String("downloader", "native", "Download backend to use, native or aria2")
+	aria2ConnectionsPtr := flag.Int("aria2-connections", 8, "Number of connections aria2 uses for each file")
+	retriesPtr := flag.Int("retries", 5, "Maximum number of attempts for each HTTP request")
+	parallelDepsPtr := flag.Bool("parallel-deps", false, "Check the dependencies in parallel")
+	skipDepsPtr := flag.Bool("skip-deps", false, "Use the installed dependencies without checking for updates or downloading them")
+	ffmpegPathPtr := flag.String("ffmpeg-path", "", "Path of the ffmpeg binary to use")
+	aria2PathPtr := flag.String("aria2-path", "", "Path of the aria2c binary to use")
+	ffmpegVersionPtr := flag.String("ffmpeg-version", "latest", "FFMPEG version to use: latest, a pinned version like 5.1.2 or a minimum like >=5.1")
+	aria2VersionPtr := flag.String("aria2-version", "latest", "aria2 version to use: latest, a pinned version or a minimum like >=1.36.0")
 	flag.Parse()
 
+	level, err := ParseLogLevel(*logLevelPtr)
+	if err != nil {
+		Critical(err.Error())
+	}
+	logLevel = level
+
+	if *logFormatPtr != "text" && *logFormatPtr != "json" {
+		Criticalf("Unknown log format: %s", *logFormatPtr)
+	}
+	logFormat = *logFormatPtr
+
+	// an explicit level wins over the debug default of development builds
+	flag.Visit(func(f *flag.Flag) {
+		if f.Name == "log-level" {
+			debug = false
+		}
+	})
 	if *debugPtr {
 		debug = true
 	}
 
+	if *logFilePtr != "" {
+		err = SetLogFile(*logFilePtr)
+		if err != nil {
+			Criticalf("Failed to open log file: %s", err)
+		}
+	}
+
+	httpRetryTransport.MaxAttempts = *retriesPtr
+
 	if *versionPtr {
 		Infof("Running version: %s", version)
 		os.Exit(0)
 	}
 
-	if *bearerPtr == "" {
-		Critical("A bearer token is required!")
+	// loading the course information from a file doesn't need any API calls
+	if *loadInfoPtr == "" {
+		if *bearerPtr == "" {
+			Critical("A bearer token is required!")
+		}
+
+		if *courseUrlPtr == "" {
+			Critical("A Course URL is required!")
+		}
 	}
 
-	if *courseUrlPtr == "" {
-		Critical("A Course URL is required!")
+	if *infoFormatPtr != "text" && *infoFormatPtr != "json" {
+		Criticalf("Unknown info format: %s", *infoFormatPtr)
 	}
 
-	ffmpegStatus, aria2Status, ytdlpStatus, shakaStatus, err := RunDependencyCheck()
+	if *downloaderPtr != "native" && *downloaderPtr != "aria2" {
+		Criticalf("Unknown downloader: %s", *downloaderPtr)
+	}
 
+	captions, err := ParseCaptionSelection(*captionsPtr)
 	if err != nil {
-		Criticalf("Dependency Check Error: %s", err)
+		Critical(err.Error())
 	}
 
-	// Print the status of all the checks
-	if ffmpegStatus {
-		Logf(SUCCESS, "FFMPEG: %t", ffmpegStatus)
-	} else {
-		Logf(ERROR, "FFMPEG: %t", ffmpegStatus)
+	if *captionFormatPtr != "srt" && *captionFormatPtr != "vtt" {
+		Criticalf("Unknown captions format: %s", *captionFormatPtr)
 	}
 
-	if aria2Status {
-		Logf(SUCCESS, "ARIA2: %t", aria2Status)
-	} else {
-		Logf(ERROR, "ARIA2: %t", aria2Status)
+	quality, err := ParseQuality(*qualityPtr)
+	if err != nil {
+		Critical(err.Error())
 	}
 
-	if ytdlpStatus {
-		Logf(SUCCESS, "YTDLP: %t", ytdlpStatus)
-	} else {
-		Logf(ERROR, "YTDLP: %t", ytdlpStatus)
+	// keep stdout clean for scripts reading the JSON
+	if *infoPtr && *infoFormatPtr == "json" {
+		logWriter = os.Stderr
 	}
 
-	if shakaStatus {
-		Logf(SUCCESS, "SHAKA: %t", shakaStatus)
+	// the info mode doesn't download anything so it doesn't need the dependencies
+	var deps *DependencyReport
+	if !*infoPtr {
+		registry := NewDefaultDependencyRegistry(*downloaderPtr == "aria2")
+		registry.SetOffline(*skipDepsPtr)
+		overrides := []struct {
+			name    string
+			path    string
+			version string
+		}{
+			{"FFMPEG", *ffmpegPathPtr, *ffmpegVersionPtr},
+			{"aria2", *aria2PathPtr, *aria2VersionPtr},
+		}
+		for _, override := range overrides {
+			policy, err := ParseVersionPolicy(override.version)
+			if err != nil {
+				Criticalf("Invalid %s version: %s", override.name, err)
+			}
+			// unregistered dependencies (aria2 with the native backend) are left alone
+			registry.Configure(override.name, func(options *DependencyOptions) {
+				options.Path = override.path
+				options.Policy = policy
+			})
+		}
+		deps = runDependencyCheck(registry, *parallelDepsPtr)
+	}
+
+	var course *Course
+	var udemy *UdemyClient
+	if *loadInfoPtr != "" {
+		Infof("Loading course information from %s...", *loadInfoPtr)
+		course, err = LoadCourseInfo(*loadInfoPtr)
+		if err != nil {
+			Criticalf("Failed to load course information: %s", err)
+		}
 	} else {
-		Logf(ERROR, "SHAKA: %t", shakaStatus)
+		course, udemy, err = fetchCourse(*bearerPtr, *courseUrlPtr)
+		if err != nil {
+			Criticalf("%s", err)
+		}
+	}
+	Successf("Course: %s (%d), %d chapters and %d lectures", course.Title, course.ID, len(course.Chapters), course.LectureCount())
+
+	if *saveInfoPtr != "" {
+		err = SaveCourseInfo(*saveInfoPtr, course)
+		if err != nil {
+			Criticalf("Failed to save course information: %s", err)
+		}
+		Successf("Saved course information to %s", *saveInfoPtr)
+	}
+
+	if *infoPtr {
+		outline := BuildCourseOutline(course)
+		if *infoFormatPtr == "json" {
+			err = PrintCourseOutlineJSON(os.Stdout, outline)
+			if err != nil {
+				Criticalf("Failed to print course information: %s", err)
+			}
+		} else {
+			PrintCourseOutline(os.Stdout, outline)
+		}
+		os.Exit(0)
+	}
+
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+
+	downloader := NewCourseDownloader(udemy, *outputPtr, *concurrencyPtr)
+	downloader.Quality = quality
+	downloader.Captions = captions
+	downloader.CaptionFormat = *captionFormatPtr
+	downloader.ArticleMarkdown = *articleMarkdownPtr
+	downloader.HLS = NewHLSDownloader(deps.Get("FFMPEG").Path)
+	var aria2 *Aria2Backend
+	if *downloaderPtr == "aria2" {
+		aria2, err = StartAria2(deps.Get("aria2").Path, *aria2ConnectionsPtr)
+		if err != nil {
+			Criticalf("%s", err)
+		}
+		downloader.Backend = aria2
+	}
+	err = downloader.Run(ctx, course)
+
+	// Critical exits without running deferred calls, so aria2c has to be stopped before anything below can exit
+	if aria2 != nil {
+		aria2.Close()
+	}
+
+	// save the chosen qualities so a later run can tell when an upgrade is available, -load-info files are never overwritten
+	if *saveInfoPtr != "" {
+		saveErr := SaveCourseInfo(*saveInfoPtr, course)
+		if saveErr != nil {
+			Errorf("Failed to save course information: %s", saveErr)
+		}
+	}
+
+	if errors.Is(err, context.Canceled) {
+		Critical("Download cancelled")
+	}
+	if err != nil {
+		Criticalf("%s", err)
 	}
+	Success("Course downloaded!")
+}
+
+// Runs the dependency checks and exits if any of the required ones failed
+func runDependencyCheck(registry *DependencyRegistry, parallel bool) *DependencyReport {
+	report := registry.Run(parallel)
+
+	// Print the status of all the checks
+	for _, result := range report.Results {
+		if result.OK() {
+			Logf(SUCCESS, "%s: %s (%s)", result.Name, result.Version, result.Path)
+			continue
+		}
 
-	if !ffmpegStatus || !aria2Status || !ytdlpStatus || !shakaStatus {
+		// optional dependencies only get a warning
+		level := ERROR
+		if !result.Required {
+			level = WARNING
+		}
+		if result.Err != nil {
+			Logf(level, "%s: %s", result.Name, result.Err)
+		} else {
+			Logf(level, "%s: not installed", result.Name)
+		}
+	}
+
+	if !report.OK() {
 		Critical("One or more dependencies are missing!")
 	}
+
+	return report
+}
+
+// Resolves the course and gets its curriculum from the API
+func fetchCourse(bearer, courseUrl string) (*Course, *UdemyClient, error) {
+	target, err := ParseCourseURL(courseUrl)
+	if err != nil {
+		return nil, nil, fmt.Errorf("Invalid course: %s", err)
+	}
+
+	udemy := NewUdemyClient(bearer, target.PortalName)
+	info, err := udemy.ResolveCourse(target)
+	if err != nil {
+		return nil, nil, fmt.Errorf("Failed to resolve course: %s", err)
+	}
+	Infof("Found course %s (%d) on portal %s", info.Title, info.ID, target.PortalName)
+
+	Info("Getting course curriculum...")
+	items, err := udemy.GetCurriculumItems(info.ID)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	course, err := BuildCourse(info, target.PortalName, items)
+	if err != nil {
+		return nil, nil, fmt.Errorf("Failed to parse course curriculum: %s", err)
+	}
+
+	return course, udemy, nil
 }
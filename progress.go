@@ -0,0 +1,83 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"sync"
+	"time"
+
+	"github.com/k0kubun/go-ansi"
+	"github.com/schollz/progressbar/v3"
+)
+
+// Progress bars redraw their line in place, which only works on a terminal. Elsewhere finished files are logged instead.
+// JSON logs never get bars, they would end up between the objects.
+func ShowProgress() bool {
+	return logFormat != "json" && isTerminal(os.Stdout)
+}
+
+// Draws several progress bars on their own lines below each other, each line is redrawn in place with ANSI cursor movement
+type MultiProgress struct {
+	mu    sync.Mutex
+	out   io.Writer
+	lines int
+	// without progress every line is discarded
+	enabled bool
+}
+
+// Writer for a single line of a MultiProgress
+type progressLine struct {
+	parent *MultiProgress
+	index  int
+}
+
+func NewMultiProgress() *MultiProgress {
+	return &MultiProgress{out: ansi.NewAnsiStdout(), enabled: ShowProgress()}
+}
+
+// Reserves a new line at the bottom and returns its writer
+func (m *MultiProgress) AddLine() io.Writer {
+	if !m.enabled {
+		return io.Discard
+	}
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	fmt.Fprintln(m.out)
+	m.lines++
+	return &progressLine{parent: m, index: m.lines - 1}
+}
+
+func (l *progressLine) Write(p []byte) (int, error) {
+	m := l.parent
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	// the cursor always sits on the empty line below the last bar
+	up := m.lines - l.index
+	fmt.Fprintf(m.out, "\033[%dA\r\033[2K", up)
+	n, err := m.out.Write(p)
+	fmt.Fprintf(m.out, "\033[%dB\r", up)
+
+	return n, err
+}
+
+// Creates a byte progress bar, the same style DownloadFile uses
+func NewDownloadBar(w io.Writer, max int64, description string) *progressbar.ProgressBar {
+	return progressbar.NewOptions64(max,
+		progressbar.OptionSetWriter(w),
+		progressbar.OptionEnableColorCodes(true),
+		progressbar.OptionShowBytes(true),
+		progressbar.OptionSetWidth(15),
+		progressbar.OptionThrottle(100*time.Millisecond),
+		progressbar.OptionSetDescription(description),
+		progressbar.OptionSetTheme(progressbar.Theme{
+			Saucer:        "[green]=[reset]",
+			SaucerHead:    "[green]>[reset]",
+			SaucerPadding: " ",
+			BarStart:      "[",
+			BarEnd:        "]",
+		}))
+}
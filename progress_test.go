@@ -0,0 +1,33 @@
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"testing"
+)
+
+func TestMultiProgress(t *testing.T) {
+	out := &bytes.Buffer{}
+	progress := &MultiProgress{out: out, enabled: true}
+	first := progress.AddLine()
+	progress.AddLine()
+	out.Reset()
+
+	// the first of two lines is two lines above the cursor
+	fmt.Fprint(first, "bar")
+	if got := out.String(); got != "\033[2A\r\033[2Kbar\033[2B\r" {
+		t.Errorf("got %q", got)
+	}
+}
+
+func TestMultiProgressDisabled(t *testing.T) {
+	out := &bytes.Buffer{}
+	progress := &MultiProgress{out: out}
+	line := progress.AddLine()
+	fmt.Fprint(line, "bar")
+
+	if line != io.Discard || out.Len() > 0 {
+		t.Errorf("nothing should be drawn without a terminal, got %q", out.String())
+	}
+}
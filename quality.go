@@ -0,0 +1,144 @@
+package main
+
+import (
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+type QualityMode int
+
+const (
+	QualityBest QualityMode = iota
+	QualityWorst
+	// A specific height, see SelectVideoSource for what happens when it is missing
+	QualityExact
+	// The highest height that isn't above the limit
+	QualityAtMost
+)
+
+// The -quality option, resolved against the sources of each lecture
+type QualityPreference struct {
+	Mode   QualityMode
+	Height int
+}
+
+// Parses best, worst, a height like 720 (or 720p) or a limit like <=1080
+func ParseQuality(s string) (QualityPreference, error) {
+	s = strings.ToLower(strings.TrimSpace(s))
+
+	switch s {
+	case "best", "":
+		return QualityPreference{Mode: QualityBest}, nil
+	case "worst":
+		return QualityPreference{Mode: QualityWorst}, nil
+	}
+
+	mode := QualityExact
+	if strings.HasPrefix(s, "<=") {
+		mode = QualityAtMost
+		s = strings.TrimSpace(strings.TrimPrefix(s, "<="))
+	}
+
+	height, err := strconv.Atoi(strings.TrimSuffix(s, "p"))
+	if err != nil || height <= 0 {
+		return QualityPreference{}, fmt.Errorf("Invalid quality %q, use best, worst, a height like 720 or a limit like <=1080", s)
+	}
+
+	return QualityPreference{Mode: mode, Height: height}, nil
+}
+
+func (q QualityPreference) String() string {
+	switch q.Mode {
+	case QualityWorst:
+		return "worst"
+	case QualityExact:
+		return fmt.Sprintf("%dp", q.Height)
+	case QualityAtMost:
+		return fmt.Sprintf("<=%dp", q.Height)
+	}
+	return "best"
+}
+
+// A progressive MP4 a video can be downloaded from
+type VideoSource struct {
+	URL    string
+	Height int
+}
+
+// The progressive MP4 sources of a video, highest first, each height only once
+func (v *VideoAsset) Sources() []VideoSource {
+	sources := []VideoSource{}
+	seen := map[int]bool{}
+	add := func(url, label, mimeType string) {
+		height, err := strconv.Atoi(strings.TrimSuffix(label, "p"))
+		if err != nil || mimeType != "video/mp4" || url == "" || seen[height] {
+			return
+		}
+		seen[height] = true
+		sources = append(sources, VideoSource{URL: url, Height: height})
+	}
+
+	for _, u := range v.DownloadURLs {
+		add(u.File, u.Label, u.Type)
+	}
+	for _, u := range v.StreamURLs {
+		add(u.File, u.Label, u.Type)
+	}
+	for _, s := range v.MediaSources {
+		add(s.Src, s.Label, s.Type)
+	}
+
+	sort.SliceStable(sources, func(i, j int) bool {
+		return sources[i].Height > sources[j].Height
+	})
+	return sources
+}
+
+// Picks the source for a preference from sources sorted highest first.
+// When the exact height is missing the closest lower one is used, and when there is nothing lower the closest higher one.
+// A limit works the same way: the highest height within the limit, otherwise the lowest one there is.
+func (q QualityPreference) Select(sources []VideoSource) (VideoSource, bool) {
+	if len(sources) == 0 {
+		return VideoSource{}, false
+	}
+
+	switch q.Mode {
+	case QualityWorst:
+		return sources[len(sources)-1], true
+	case QualityExact, QualityAtMost:
+		for _, source := range sources {
+			if source.Height <= q.Height {
+				return source, true
+			}
+		}
+		return sources[len(sources)-1], true
+	}
+
+	return sources[0], true
+}
+
+// Picks the source of a video for a preference, see QualityPreference.Select for the fallback rule
+func SelectVideoSource(video *VideoAsset, quality QualityPreference) (VideoSource, bool) {
+	return quality.Select(video.Sources())
+}
+
+// The HLS playlist of a video, used when there is no progressive source. Empty when there is none.
+func (v *VideoAsset) HLSPlaylistURL() string {
+	isHLS := func(url, mimeType string) bool {
+		return url != "" && (strings.EqualFold(mimeType, "application/x-mpegURL") || strings.Contains(strings.ToLower(url), ".m3u8"))
+	}
+
+	for _, s := range v.MediaSources {
+		if isHLS(s.Src, s.Type) {
+			return s.Src
+		}
+	}
+	for _, u := range v.StreamURLs {
+		if isHLS(u.File, u.Type) {
+			return u.File
+		}
+	}
+	return ""
+}
@@ -0,0 +1,137 @@
+package main
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestParseQuality(t *testing.T) {
+	tests := []struct {
+		raw      string
+		expected QualityPreference
+		err      bool
+	}{
+		{raw: "", expected: QualityPreference{Mode: QualityBest}},
+		{raw: "best", expected: QualityPreference{Mode: QualityBest}},
+		{raw: " Worst ", expected: QualityPreference{Mode: QualityWorst}},
+		{raw: "720", expected: QualityPreference{Mode: QualityExact, Height: 720}},
+		{raw: "720p", expected: QualityPreference{Mode: QualityExact, Height: 720}},
+		{raw: "<=1080", expected: QualityPreference{Mode: QualityAtMost, Height: 1080}},
+		{raw: "<= 480p", expected: QualityPreference{Mode: QualityAtMost, Height: 480}},
+		{raw: "hd", err: true},
+		{raw: "<=abc", err: true},
+		{raw: "0", err: true},
+		{raw: "-720", err: true},
+	}
+
+	for _, test := range tests {
+		t.Run(test.raw, func(t *testing.T) {
+			quality, err := ParseQuality(test.raw)
+			if test.err {
+				if err == nil {
+					t.Errorf("expected an error, got %+v", quality)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			if quality != test.expected {
+				t.Errorf("got %+v, expected %+v", quality, test.expected)
+			}
+		})
+	}
+}
+
+func TestSelectVideoSource(t *testing.T) {
+	video := &VideoAsset{
+		DownloadURLs: []UdemyDownloadURL{{Type: "video/mp4", File: "d360", Label: "360"}, {Type: "video/mp4", File: "d1080", Label: "1080"}},
+		MediaSources: []UdemyMediaSource{{Type: "video/mp4", Src: "m720", Label: "720"}, {Type: "application/x-mpegURL", Src: "hls", Label: "auto"}},
+	}
+
+	tests := []struct {
+		quality  string
+		expected int
+	}{
+		{"best", 1080},
+		{"worst", 360},
+		{"720", 720},
+		// a missing height falls back to the closest lower one
+		{"480", 360},
+		// and to the closest higher one when there is nothing lower
+		{"240", 360},
+		{"2160", 1080},
+		{"<=1080", 1080},
+		{"<=900", 720},
+		{"<=100", 360},
+	}
+
+	for _, test := range tests {
+		t.Run(test.quality, func(t *testing.T) {
+			quality, err := ParseQuality(test.quality)
+			if err != nil {
+				t.Fatal(err)
+			}
+			source, ok := SelectVideoSource(video, quality)
+			if !ok || source.Height != test.expected {
+				t.Errorf("got %dp (%v), expected %dp", source.Height, ok, test.expected)
+			}
+		})
+	}
+
+	if _, ok := SelectVideoSource(&VideoAsset{}, QualityPreference{}); ok {
+		t.Error("a video without sources shouldn't select anything")
+	}
+}
+
+func TestVideoAssetSources(t *testing.T) {
+	tests := []struct {
+		name      string
+		video     VideoAsset
+		sources   []VideoSource
+		qualities []int
+	}{
+		{
+			name: "stream urls only",
+			video: VideoAsset{StreamURLs: []UdemyDownloadURL{
+				{Type: "video/mp4", File: "s720", Label: "720"},
+				{Type: "application/x-mpegURL", File: "index.m3u8", Label: "auto"},
+			}},
+			sources:   []VideoSource{{URL: "s720", Height: 720}},
+			qualities: []int{720},
+		},
+		{
+			name: "duplicate heights keep the first source",
+			video: VideoAsset{
+				DownloadURLs: []UdemyDownloadURL{{Type: "video/mp4", File: "d720", Label: "720"}},
+				StreamURLs:   []UdemyDownloadURL{{Type: "video/mp4", File: "s720", Label: "720p"}, {Type: "video/mp4", File: "s1080", Label: "1080p"}},
+				MediaSources: []UdemyMediaSource{{Type: "video/mp4", Src: "m480", Label: "480"}},
+			},
+			sources:   []VideoSource{{URL: "s1080", Height: 1080}, {URL: "d720", Height: 720}, {URL: "m480", Height: 480}},
+			qualities: []int{1080, 720, 480},
+		},
+		{
+			name:      "HLS and DASH only",
+			video:     VideoAsset{MediaSources: []UdemyMediaSource{{Type: "application/dash+xml", Src: "manifest.mpd", Label: "1080"}}},
+			sources:   []VideoSource{},
+			qualities: []int{},
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			if sources := test.video.Sources(); !reflect.DeepEqual(sources, test.sources) {
+				t.Errorf("got sources %+v, expected %+v", sources, test.sources)
+			}
+			if qualities := test.video.Qualities(); !reflect.DeepEqual(qualities, test.qualities) {
+				t.Errorf("got qualities %v, expected %v", qualities, test.qualities)
+			}
+		})
+	}
+
+	// a progressive stream url means the video isn't DRM protected
+	video := VideoAsset{StreamURLs: []UdemyDownloadURL{{Type: "video/mp4", File: "s720", Label: "720"}}, MediaLicenseToken: "token"}
+	if video.IsDRM() {
+		t.Error("a video with a progressive stream url shouldn't be skipped as DRM")
+	}
+}
@@ -0,0 +1,143 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"net/url"
+	"regexp"
+	"strconv"
+	"strings"
+)
+
+// What we know about a course after parsing the -course argument, either the ID or the slug can be missing
+type CourseTarget struct {
+	PortalName string
+	CourseID   int
+	Slug       string
+}
+
+var ErrNotEnrolled = errors.New("not enrolled in course")
+
+var slugRegex = regexp.MustCompile(`^[A-Za-z0-9_-]+$`)
+
+// Parses a course URL, a business portal URL, a numeric course ID or a course slug
+func ParseCourseURL(input string) (*CourseTarget, error) {
+	input = strings.TrimSpace(input)
+	if input == "" {
+		return nil, fmt.Errorf("empty course URL")
+	}
+
+	// bare numeric ID
+	if id, err := strconv.Atoi(input); err == nil {
+		if id <= 0 {
+			return nil, fmt.Errorf("invalid course ID: %d", id)
+		}
+		return &CourseTarget{PortalName: "www", CourseID: id}, nil
+	}
+
+	// bare slug
+	if slugRegex.MatchString(input) {
+		return &CourseTarget{PortalName: "www", Slug: input}, nil
+	}
+
+	if !strings.Contains(input, "://") {
+		input = "https://" + input
+	}
+
+	u, err := url.Parse(input)
+	if err != nil {
+		return nil, fmt.Errorf("invalid course URL: %s", err)
+	}
+
+	host := strings.ToLower(u.Hostname())
+	if host != "udemy.com" && !strings.HasSuffix(host, ".udemy.com") {
+		return nil, fmt.Errorf("%s is not a udemy.com URL", u.Hostname())
+	}
+
+	target := &CourseTarget{PortalName: "www"}
+	if host != "udemy.com" {
+		target.PortalName = strings.TrimSuffix(host, ".udemy.com")
+	}
+
+	// course-dashboard-redirect style links carry the ID in the query
+	if id, err := strconv.Atoi(u.Query().Get("course_id")); err == nil && id > 0 {
+		target.CourseID = id
+	}
+
+	segments := strings.Split(strings.Trim(u.Path, "/"), "/")
+	for i, segment := range segments {
+		if segment == "course" && i+1 < len(segments) && slugRegex.MatchString(segments[i+1]) {
+			target.Slug = segments[i+1]
+			break
+		}
+	}
+
+	if target.CourseID == 0 && target.Slug == "" {
+		return nil, fmt.Errorf("could not find a course in URL: %s", input)
+	}
+
+	return target, nil
+}
+
+// Fills in the missing course ID by looking the slug up in the subscribed courses and makes sure the user is enrolled
+func (c *UdemyClient) ResolveCourse(target *CourseTarget) (*UdemyCourse, error) {
+	if target.CourseID != 0 {
+		info, err := c.GetCourseInfo(target.CourseID)
+		if err != nil {
+			return nil, err
+		}
+
+		course, err := c.findSubscribedCourse(info.PublishedTitle, func(course UdemyCourse) bool {
+			return course.ID == target.CourseID
+		})
+		if err != nil {
+			return nil, err
+		}
+		if course == nil {
+			return nil, fmt.Errorf("%w: %q (%d), make sure the bearer token belongs to an account that owns it", ErrNotEnrolled, info.Title, info.ID)
+		}
+
+		return course, nil
+	}
+
+	course, err := c.findSubscribedCourse(target.Slug, func(course UdemyCourse) bool {
+		return course.PublishedTitle == target.Slug || strings.Trim(course.URL, "/") == "course/"+target.Slug
+	})
+	if err != nil {
+		return nil, err
+	}
+	if course == nil {
+		return nil, fmt.Errorf("%w: %q was not found in your subscribed courses on %s", ErrNotEnrolled, target.Slug, target.PortalName)
+	}
+
+	target.CourseID = course.ID
+	return course, nil
+}
+
+// Searches the subscribed courses first since it is cheaper, then falls back to the full list
+func (c *UdemyClient) findSubscribedCourse(search string, match func(course UdemyCourse) bool) (*UdemyCourse, error) {
+	if search != "" {
+		courses, err := c.SearchSubscribedCourses(search)
+		if err != nil {
+			return nil, err
+		}
+		for _, course := range courses {
+			if match(course) {
+				return &course, nil
+			}
+		}
+	}
+
+	Debug("Course not found by search, checking all subscribed courses...")
+	courses, err := c.GetSubscribedCourses()
+	if err != nil {
+		return nil, err
+	}
+	for _, course := range courses {
+		if match(course) {
+			return &course, nil
+		}
+	}
+
+	return nil, nil
+}
@@ -0,0 +1,132 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestParseCourseURL(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected CourseTarget
+	}{
+		{"https://www.udemy.com/course/learn-go/", CourseTarget{PortalName: "www", Slug: "learn-go"}},
+		{"https://www.udemy.com/course/learn-go/learn/lecture/123#overview", CourseTarget{PortalName: "www", Slug: "learn-go"}},
+		{"udemy.com/course/learn-go", CourseTarget{PortalName: "www", Slug: "learn-go"}},
+		{"https://acme.udemy.com/course/learn_go/", CourseTarget{PortalName: "acme", Slug: "learn_go"}},
+		{"https://ACME.Udemy.com/course/learn-go/", CourseTarget{PortalName: "acme", Slug: "learn-go"}},
+		{"https://acme.udemy.com/course-dashboard-redirect/?course_id=456", CourseTarget{PortalName: "acme", CourseID: 456}},
+		{"https://www.udemy.com/cart/subscribe/course/learn-go/?course_id=456", CourseTarget{PortalName: "www", CourseID: 456, Slug: "learn-go"}},
+		{" 123 ", CourseTarget{PortalName: "www", CourseID: 123}},
+		{"learn-go", CourseTarget{PortalName: "www", Slug: "learn-go"}},
+	}
+
+	for _, test := range tests {
+		t.Run(test.input, func(t *testing.T) {
+			target, err := ParseCourseURL(test.input)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if *target != test.expected {
+				t.Errorf("got %+v, expected %+v", *target, test.expected)
+			}
+		})
+	}
+}
+
+func TestParseCourseURLErrors(t *testing.T) {
+	tests := []string{
+		"",
+		"0",
+		"-5",
+		"https://example.com/course/learn-go/",
+		"https://udemy.com.example.com/course/learn-go/",
+		"https://notudemy.com/course/learn-go/",
+		"https://www.udemy.com/",
+		"https://www.udemy.com/course/",
+		"https://www.udemy.com/?course_id=abc",
+	}
+
+	for _, input := range tests {
+		if target, err := ParseCourseURL(input); err == nil {
+			t.Errorf("expected %q to be rejected, got %+v", input, *target)
+		}
+	}
+}
+
+// Serves the course info and subscribed courses endpoints, searches only find courses by their title
+func newTestResolverServer(t *testing.T, subscribed []UdemyCourse) *httptest.Server {
+	return httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch {
+		case r.URL.Path == "/api-2.0/users/me/subscribed-courses":
+			courses := []UdemyCourse{}
+			search := r.URL.Query().Get("search")
+			for _, course := range subscribed {
+				if search == "" || strings.Contains(course.Title, search) {
+					courses = append(courses, course)
+				}
+			}
+			results, _ := json.Marshal(courses)
+			json.NewEncoder(w).Encode(UdemyPagedResponse{Count: len(courses), Results: results})
+		case strings.HasPrefix(r.URL.Path, "/api-2.0/courses/"):
+			var id int
+			fmt.Sscanf(r.URL.Path, "/api-2.0/courses/%d/", &id)
+			fmt.Fprintf(w, `{"_class":"course","id":%d,"title":"Course %d","published_title":"course-%d"}`, id, id, id)
+		default:
+			t.Errorf("unexpected request %s", r.URL)
+			w.WriteHeader(http.StatusNotFound)
+		}
+	}))
+}
+
+func TestResolveCourse(t *testing.T) {
+	server := newTestResolverServer(t, []UdemyCourse{
+		{ID: 1, Title: "Course 1", PublishedTitle: "course-1", URL: "/course/course-1/"},
+		{ID: 2, Title: "Learn Go", PublishedTitle: "learn-go", URL: "/course/learn-go/"},
+		{ID: 3, Title: "Renamed", PublishedTitle: "old-slug", URL: "/course/new-slug/"},
+	})
+	defer server.Close()
+	client := newTestUdemyClient(server)
+
+	tests := []struct {
+		name   string
+		target CourseTarget
+		id     int
+	}{
+		// the search by published title doesn't match the title, the full list does
+		{"id", CourseTarget{PortalName: "www", CourseID: 1}, 1},
+		{"slug", CourseTarget{PortalName: "www", Slug: "learn-go"}, 2},
+		{"slug from the course url", CourseTarget{PortalName: "www", Slug: "new-slug"}, 3},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			target := test.target
+			course, err := client.ResolveCourse(&target)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if course.ID != test.id || target.CourseID != test.id {
+				t.Errorf("got course %d and target %+v, expected %d", course.ID, target, test.id)
+			}
+		})
+	}
+}
+
+func TestResolveCourseNotEnrolled(t *testing.T) {
+	server := newTestResolverServer(t, []UdemyCourse{{ID: 1, Title: "Course 1", PublishedTitle: "course-1"}})
+	defer server.Close()
+	client := newTestUdemyClient(server)
+
+	for _, target := range []CourseTarget{{PortalName: "www", CourseID: 2}, {PortalName: "www", Slug: "course-2"}} {
+		_, err := client.ResolveCourse(&target)
+		if !errors.Is(err, ErrNotEnrolled) {
+			t.Errorf("%+v: expected ErrNotEnrolled, got %v", target, err)
+		}
+	}
+}
@@ -0,0 +1,251 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+// Answers with the statuses in order and then with 200, every request and its body is recorded
+type statusSequenceServer struct {
+	mu       sync.Mutex
+	statuses []int
+	headers  map[string]string
+	bodies   []string
+	// called for every request before it is answered
+	onRequest func()
+}
+
+func (s *statusSequenceServer) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	body, _ := io.ReadAll(r.Body)
+
+	s.mu.Lock()
+	s.bodies = append(s.bodies, string(body))
+	status := http.StatusOK
+	if len(s.bodies) <= len(s.statuses) {
+		status = s.statuses[len(s.bodies)-1]
+	}
+	s.mu.Unlock()
+
+	if s.onRequest != nil {
+		s.onRequest()
+	}
+	if status != http.StatusOK {
+		for k, v := range s.headers {
+			w.Header().Set(k, v)
+		}
+	}
+	w.WriteHeader(status)
+	io.WriteString(w, "body")
+}
+
+func (s *statusSequenceServer) requests() int {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return len(s.bodies)
+}
+
+func newTestRetryTransport(server *httptest.Server, maxAttempts int, delay time.Duration) *RetryTransport {
+	return &RetryTransport{Base: server.Client().Transport, MaxAttempts: maxAttempts, BaseDelay: delay, MaxDelay: delay}
+}
+
+func TestRetryTransportRetries(t *testing.T) {
+	sequence := &statusSequenceServer{statuses: []int{http.StatusServiceUnavailable, http.StatusTooManyRequests, http.StatusBadGateway}}
+	server := httptest.NewServer(sequence)
+	defer server.Close()
+
+	client := &http.Client{Transport: newTestRetryTransport(server, 5, time.Millisecond)}
+	resp, err := client.Get(server.URL)
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK || sequence.requests() != 4 {
+		t.Errorf("got %s after %d requests, expected 200 after 4", resp.Status, sequence.requests())
+	}
+}
+
+func TestRetryTransportMaxAttempts(t *testing.T) {
+	sequence := &statusSequenceServer{statuses: []int{503, 503, 503, 503, 503}}
+	server := httptest.NewServer(sequence)
+	defer server.Close()
+
+	client := &http.Client{Transport: newTestRetryTransport(server, 3, time.Millisecond)}
+	resp, err := client.Get(server.URL)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer resp.Body.Close()
+
+	// the last response is returned as is, with its body
+	body, _ := io.ReadAll(resp.Body)
+	if resp.StatusCode != http.StatusServiceUnavailable || string(body) != "body" || sequence.requests() != 3 {
+		t.Errorf("got %s %q after %d requests, expected 503 after 3", resp.Status, body, sequence.requests())
+	}
+}
+
+func TestRetryTransportDoesNotRetryClientErrors(t *testing.T) {
+	sequence := &statusSequenceServer{statuses: []int{http.StatusNotFound}}
+	server := httptest.NewServer(sequence)
+	defer server.Close()
+
+	client := &http.Client{Transport: newTestRetryTransport(server, 5, time.Millisecond)}
+	resp, err := client.Get(server.URL)
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp.Body.Close()
+
+	if resp.StatusCode != http.StatusNotFound || sequence.requests() != 1 {
+		t.Errorf("got %s after %d requests, expected one 404", resp.Status, sequence.requests())
+	}
+}
+
+func TestRetryTransportRetryAfter(t *testing.T) {
+	tests := []struct {
+		name       string
+		retryAfter string
+	}{
+		{"seconds", "0"},
+		{"date", time.Now().Add(-time.Minute).UTC().Format(http.TimeFormat)},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			sequence := &statusSequenceServer{statuses: []int{http.StatusTooManyRequests}, headers: map[string]string{"Retry-After": test.retryAfter}}
+			server := httptest.NewServer(sequence)
+			defer server.Close()
+
+			// the backoff would take an hour, the Retry-After header says to retry right away
+			client := &http.Client{Transport: newTestRetryTransport(server, 2, time.Hour), Timeout: 10 * time.Second}
+			resp, err := client.Get(server.URL)
+			if err != nil {
+				t.Fatal(err)
+			}
+			resp.Body.Close()
+
+			if resp.StatusCode != http.StatusOK || sequence.requests() != 2 {
+				t.Errorf("got %s after %d requests", resp.Status, sequence.requests())
+			}
+		})
+	}
+}
+
+func TestRetryTransportBodies(t *testing.T) {
+	// strings.Reader bodies can be replayed
+	sequence := &statusSequenceServer{statuses: []int{503}}
+	server := httptest.NewServer(sequence)
+	defer server.Close()
+
+	client := &http.Client{Transport: newTestRetryTransport(server, 3, time.Millisecond)}
+	resp, err := client.Post(server.URL, "text/plain", strings.NewReader("payload"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusOK || strings.Join(sequence.bodies, ",") != "payload,payload" {
+		t.Errorf("got %s with bodies %q", resp.Status, sequence.bodies)
+	}
+
+	// a plain reader can only be sent once
+	sequence = &statusSequenceServer{statuses: []int{503}}
+	server2 := httptest.NewServer(sequence)
+	defer server2.Close()
+
+	client = &http.Client{Transport: newTestRetryTransport(server2, 3, time.Millisecond)}
+	resp, err = client.Post(server2.URL, "text/plain", io.MultiReader(strings.NewReader("payload")))
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusServiceUnavailable || sequence.requests() != 1 {
+		t.Errorf("got %s after %d requests, a body that can't be replayed shouldn't be retried", resp.Status, sequence.requests())
+	}
+}
+
+func TestRetryTransportCancel(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	// cancelled while waiting for the hour long backoff
+	sequence := &statusSequenceServer{statuses: []int{503, 503}, onRequest: cancel}
+	server := httptest.NewServer(sequence)
+	defer server.Close()
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, server.URL, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	client := &http.Client{Transport: newTestRetryTransport(server, 5, time.Hour)}
+	start := time.Now()
+	_, err = client.Do(req)
+	if !errors.Is(err, context.Canceled) {
+		t.Fatalf("expected the request to be cancelled, got %v", err)
+	}
+	if sequence.requests() != 1 || time.Since(start) > 10*time.Second {
+		t.Errorf("got %d requests in %s", sequence.requests(), time.Since(start))
+	}
+}
+
+func TestRetryTransportBackoff(t *testing.T) {
+	transport := &RetryTransport{BaseDelay: 100 * time.Millisecond, MaxDelay: time.Second}
+	tests := []struct {
+		attempt int
+		full    time.Duration
+	}{
+		{1, 100 * time.Millisecond},
+		{2, 200 * time.Millisecond},
+		{4, 800 * time.Millisecond},
+		// capped at MaxDelay
+		{5, time.Second},
+		{64, time.Second},
+	}
+
+	for _, test := range tests {
+		for i := 0; i < 20; i++ {
+			delay := transport.backoff(test.attempt)
+			if delay < test.full/2 || delay >= test.full {
+				t.Errorf("attempt %d: got %s, expected between %s and %s", test.attempt, delay, test.full/2, test.full)
+			}
+		}
+	}
+}
+
+func TestParseRetryAfter(t *testing.T) {
+	tests := []struct {
+		header   string
+		expected time.Duration
+		ok       bool
+	}{
+		{"", 0, false},
+		{"soon", 0, false},
+		{"0", 0, true},
+		{"30", 30 * time.Second, true},
+		{"-5", 0, true},
+		{"3600", MAX_RETRY_AFTER, true},
+		{time.Now().Add(-time.Hour).UTC().Format(http.TimeFormat), 0, true},
+		{time.Now().Add(24 * time.Hour).UTC().Format(http.TimeFormat), MAX_RETRY_AFTER, true},
+	}
+
+	for _, test := range tests {
+		t.Run(test.header, func(t *testing.T) {
+			delay, ok := parseRetryAfter(test.header)
+			if ok != test.ok || delay != test.expected {
+				t.Errorf("got %s (%v), expected %s (%v)", delay, ok, test.expected, test.ok)
+			}
+		})
+	}
+
+	// a date in the near future waits until then, give or take the second the date format rounds to
+	delay, ok := parseRetryAfter(time.Now().Add(time.Minute).UTC().Format(http.TimeFormat))
+	if !ok || delay < 58*time.Second || delay > time.Minute {
+		t.Errorf("got %s (%v), expected about a minute", delay, ok)
+	}
+}
@@ -0,0 +1,274 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"path"
+	"path/filepath"
+	"runtime"
+	"strings"
+
+	"github.com/google/go-github/v43/github"
+)
+
+// Release asset names for each platform, these are the upload names used by the go.yml workflow.
+// The workflow publishes each build as udemy-dl-go-<name> (.exe on windows) with a .sha256 file next to it and a SHA256SUMS file.
+var selfUpdateAssetNames = map[string]string{
+	"windows/amd64": "win-amd64",
+	"linux/amd64":   "linux-amd64",
+	"linux/arm64":   "linux-arm64",
+	"linux/arm":     "linux-arm",
+	"darwin/amd64":  "darwin-amd64",
+}
+
+func GetSelfUpdateAssetName() (string, error) {
+	name, ok := selfUpdateAssetNames[runtime.GOOS+"/"+runtime.GOARCH]
+	if !ok {
+		return "", fmt.Errorf("There are no udemy-dl-go builds for %s/%s", runtime.GOOS, runtime.GOARCH)
+	}
+	return name, nil
+}
+
+// Path of the running executable with symlinks resolved, so the real file gets replaced
+func selfExecutablePath() (string, error) {
+	exe, err := os.Executable()
+	if err != nil {
+		return "", err
+	}
+	return filepath.EvalSymlinks(exe)
+}
+
+// Entry point of the update subcommand
+func RunUpdateCommand(args []string) {
+	flags := flag.NewFlagSet("update", flag.ExitOnError)
+	checkPtr := flags.Bool("check", false, "Only check if an update is available")
+	forcePtr := flags.Bool("force", false, "Install the latest release even if it isn't newer")
+	rollbackPtr := flags.Bool("rollback", false, "Restore the executable that was replaced by the last update")
+	debugPtr := flags.Bool("debug", false, "Enable debug logging")
+	flags.Parse(args)
+
+	if *debugPtr {
+		debug = true
+	}
+
+	exe, err := selfExecutablePath()
+	if err != nil {
+		Criticalf("Could not find the running executable: %s", err)
+	}
+
+	if *rollbackPtr {
+		err = RollbackSelfUpdate(exe)
+		if err != nil {
+			Criticalf("Rollback failed: %s", err)
+		}
+		Success("Restored the previous version")
+		return
+	}
+
+	Infof("Running version: %s", version)
+	if version == "DEVELOPMENT" && !*forcePtr {
+		Critical("Development builds can't be updated, use -force to replace it with the latest release")
+	}
+
+	release, err := GetLatestRelease(githubClient, SELF_REPO_OWNER, SELF_REPO_NAME)
+	if err != nil {
+		Criticalf("Error getting the latest release: %s", err)
+	}
+	latestVersion := release.GetTagName()
+
+	if !*forcePtr && !IsOutdated(version, latestVersion) {
+		Successf("udemy-dl-go is up to date, current version: %s, latest version: %s", version, latestVersion)
+		return
+	}
+	Warningf("A new version is available, current version: %s, latest version: %s", version, latestVersion)
+
+	if *checkPtr {
+		return
+	}
+
+	err = SelfUpdate(exe, release)
+	if err != nil {
+		Criticalf("Update failed: %s", err)
+	}
+	Successf("Updated to %s, the previous version was kept as %s", latestVersion, exe+".old")
+}
+
+// Finds the build for this platform in a release and the checksum published for it
+func findSelfUpdateAsset(release *github.RepositoryRelease) (*github.ReleaseAsset, string, error) {
+	uploadName, err := GetSelfUpdateAssetName()
+	if err != nil {
+		return nil, "", err
+	}
+
+	assets, err := GetReleaseAssets(githubClient, SELF_REPO_OWNER, SELF_REPO_NAME, release.GetID())
+	if err != nil {
+		return nil, "", err
+	}
+
+	var asset, checksumAsset, sumsAsset *github.ReleaseAsset
+	for _, a := range assets {
+		name := strings.ToLower(a.GetName())
+		switch {
+		case strings.Contains(name, "sha256sums") || strings.Contains(name, "checksums"):
+			sumsAsset = a
+		case strings.HasSuffix(name, ".sha256") && isSelfUpdateAsset(strings.TrimSuffix(name, ".sha256"), uploadName):
+			checksumAsset = a
+		case isSelfUpdateAsset(name, uploadName):
+			asset = a
+		}
+	}
+
+	if asset == nil {
+		return nil, "", fmt.Errorf("No %s build found in release %s", uploadName, release.GetTagName())
+	}
+
+	// either a checksum file for the asset or a list of checksums for all of them
+	checksum := ""
+	if checksumAsset != nil {
+		text, err := GetText(checksumAsset.GetBrowserDownloadURL())
+		if err != nil {
+			return nil, "", fmt.Errorf("Error getting the checksum: %s", err)
+		}
+		if fields := strings.Fields(text); len(fields) > 0 {
+			checksum = strings.ToLower(fields[0])
+		}
+	} else if sumsAsset != nil {
+		text, err := GetText(sumsAsset.GetBrowserDownloadURL())
+		if err != nil {
+			return nil, "", fmt.Errorf("Error getting the checksums: %s", err)
+		}
+		checksum = findChecksum(text, asset.GetName())
+	}
+
+	if checksum == "" {
+		return nil, "", fmt.Errorf("No checksum published for %s, refusing to install it", asset.GetName())
+	}
+
+	return asset, checksum, nil
+}
+
+// Whether an asset name is the build for uploadName, like udemy-dl-go-linux-arm or udemy-dl-go-win-amd64.exe.
+// The whole name has to match so linux-arm doesn't pick up the linux-arm64 build.
+func isSelfUpdateAsset(name, uploadName string) bool {
+	name = strings.TrimSuffix(strings.TrimSuffix(strings.ToLower(name), ".zip"), ".exe")
+	return name == uploadName || name == "udemy-dl-go-"+uploadName
+}
+
+// Downloads the release build for this platform and swaps it in for exe, the old executable is kept as exe.old
+func SelfUpdate(exe string, release *github.RepositoryRelease) error {
+	asset, checksum, err := findSelfUpdateAsset(release)
+	if err != nil {
+		return err
+	}
+
+	// everything is downloaded next to the executable so the final rename stays on one filesystem
+	isZip := strings.HasSuffix(strings.ToLower(asset.GetName()), ".zip")
+	downloadPath := exe + ".download"
+	if isZip {
+		downloadPath += ".zip"
+	}
+	newPath := exe + ".new"
+	defer os.Remove(downloadPath)
+	defer os.Remove(newPath)
+
+	Debugf("Downloading %s from: %s", asset.GetName(), asset.GetBrowserDownloadURL())
+	err = DownloadFileSHA256(asset.GetBrowserDownloadURL(), downloadPath, checksum)
+	if err != nil {
+		return fmt.Errorf("Error downloading %s: %s", asset.GetName(), err)
+	}
+
+	if isZip {
+		err = extractSelfUpdateZip(downloadPath, newPath)
+	} else {
+		err = os.Rename(downloadPath, newPath)
+	}
+	if err != nil {
+		return err
+	}
+
+	err = os.Chmod(newPath, 0755)
+	if err != nil {
+		return err
+	}
+
+	return replaceExecutable(exe, newPath)
+}
+
+// The workflow uploads the executable on its own inside a zip
+func extractSelfUpdateZip(source, dest string) error {
+	archive, err := OpenArchive(source)
+	if err != nil {
+		return err
+	}
+	defer archive.Close()
+
+	for {
+		entry, r, err := archive.Next()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return err
+		}
+
+		name := path.Base(entry.Name)
+		if entry.IsDir || entry.Link != "" || (name != "udemy-dl-go" && name != "udemy-dl-go.exe") {
+			continue
+		}
+
+		return extractArchiveFile(dest, 0755, r)
+	}
+
+	return fmt.Errorf("No executable found in %s", filepath.Base(source))
+}
+
+// Moves exe to exe.old and newPath to exe, the old executable is put back if the second rename fails
+func replaceExecutable(exe, newPath string) error {
+	oldPath := exe + ".old"
+
+	err := os.Remove(oldPath)
+	if err != nil && !os.IsNotExist(err) {
+		return fmt.Errorf("Error removing the previous backup: %s", err)
+	}
+
+	// a running executable can be renamed on every platform, even though windows won't let us delete it
+	err = os.Rename(exe, oldPath)
+	if err != nil {
+		return fmt.Errorf("Error backing up the executable: %s", err)
+	}
+
+	err = os.Rename(newPath, exe)
+	if err != nil {
+		if restoreErr := os.Rename(oldPath, exe); restoreErr != nil {
+			return fmt.Errorf("Error installing the new executable: %s, restoring the old one failed too: %s", err, restoreErr)
+		}
+		return fmt.Errorf("Error installing the new executable: %s", err)
+	}
+
+	return nil
+}
+
+// Puts exe.old back in place of exe
+func RollbackSelfUpdate(exe string) error {
+	oldPath := exe + ".old"
+	if !FileExists(oldPath) {
+		return fmt.Errorf("No previous version found at %s", oldPath)
+	}
+
+	// the current executable becomes the backup, so the rollback can be undone too
+	tmpPath := exe + ".rollback"
+	err := os.Rename(exe, tmpPath)
+	if err != nil {
+		return err
+	}
+
+	err = os.Rename(oldPath, exe)
+	if err != nil {
+		os.Rename(tmpPath, exe)
+		return err
+	}
+
+	return os.Rename(tmpPath, oldPath)
+}
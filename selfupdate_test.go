@@ -0,0 +1,29 @@
+package main
+
+import "testing"
+
+func TestIsSelfUpdateAsset(t *testing.T) {
+	tests := []struct {
+		name       string
+		uploadName string
+		expected   bool
+	}{
+		{"udemy-dl-go-linux-arm", "linux-arm", true},
+		{"udemy-dl-go-linux-arm64", "linux-arm", false},
+		{"udemy-dl-go-linux-arm64", "linux-arm64", true},
+		{"udemy-dl-go-win-amd64.exe", "win-amd64", true},
+		{"Udemy-DL-Go-Darwin-AMD64.zip", "darwin-amd64", true},
+		{"linux-amd64", "linux-amd64", true},
+		{"linux-amd64.zip", "linux-amd64", true},
+		{"udemy-dl-go-linux-amd64-debug", "linux-amd64", false},
+		{"SHA256SUMS", "linux-amd64", false},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			if got := isSelfUpdateAsset(test.name, test.uploadName); got != test.expected {
+				t.Errorf("isSelfUpdateAsset(%q, %q) = %v, expected %v", test.name, test.uploadName, got, test.expected)
+			}
+		})
+	}
+}
@@ -0,0 +1,245 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+)
+
+// Udemy API client, fills in the templated URLs from constants.go and sends authenticated requests
+type UdemyClient struct {
+	Bearer     string
+	PortalName string
+	// BaseURL replaces the "https://{portal_name}.udemy.com" part of the API templates when set, mainly used for testing
+	BaseURL    string
+	HTTPClient *http.Client
+}
+
+// Generic paginated response returned by the Udemy API
+type UdemyPagedResponse struct {
+	Count    int             `json:"count"`
+	Next     string          `json:"next"`
+	Previous string          `json:"previous"`
+	Results  json.RawMessage `json:"results"`
+}
+
+type UdemyCourse struct {
+	Class          string `json:"_class"`
+	ID             int    `json:"id"`
+	Title          string `json:"title"`
+	URL            string `json:"url"`
+	PublishedTitle string `json:"published_title"`
+}
+
+type UdemyDownloadURL struct {
+	Type  string `json:"type"`
+	File  string `json:"file"`
+	Label string `json:"label"`
+}
+
+type UdemyMediaSource struct {
+	Type  string `json:"type"`
+	Src   string `json:"src"`
+	Label string `json:"label"`
+}
+
+type UdemyCaption struct {
+	ID         int    `json:"id"`
+	Locale     string `json:"locale_id"`
+	URL        string `json:"url"`
+	FileName   string `json:"file_name"`
+	Title      string `json:"title"`
+	VideoLabel string `json:"video_label"`
+	Source     string `json:"source"`
+	Status     int    `json:"status"`
+}
+
+type UdemyAsset struct {
+	Class             string                        `json:"_class"`
+	ID                int                           `json:"id"`
+	Title             string                        `json:"title"`
+	AssetType         string                        `json:"asset_type"`
+	Filename          string                        `json:"filename"`
+	ExternalURL       string                        `json:"external_url"`
+	TimeEstimation    int                           `json:"time_estimation"`
+	DownloadURLs      map[string][]UdemyDownloadURL `json:"download_urls"`
+	StreamURLs        map[string][]UdemyDownloadURL `json:"stream_urls"`
+	SlideURLs         []string                      `json:"slide_urls"`
+	MediaSources      []UdemyMediaSource            `json:"media_sources"`
+	Captions          []UdemyCaption                `json:"captions"`
+	MediaLicenseToken string                        `json:"media_license_token"`
+	CourseIsDRMed     bool                          `json:"course_is_drmed"`
+	Body              string                        `json:"body"`
+}
+
+// A single entry of the flat curriculum list, the _class field tells if it is a chapter, lecture or quiz
+type UdemyCurriculumItem struct {
+	Class               string       `json:"_class"`
+	ID                  int          `json:"id"`
+	Title               string       `json:"title"`
+	ObjectIndex         int          `json:"object_index"`
+	SortOrder           int          `json:"sort_order"`
+	Asset               *UdemyAsset  `json:"asset"`
+	SupplementaryAssets []UdemyAsset `json:"supplementary_assets"`
+}
+
+func NewUdemyClient(bearer, portalName string) *UdemyClient {
+	return &UdemyClient{
+		Bearer:     bearer,
+		PortalName: portalName,
+		HTTPClient: httpClient,
+	}
+}
+
+// Fills in the {placeholders} of a URL template, the portal name is always filled in from the client
+func (c *UdemyClient) ExpandURL(template string, params map[string]string) string {
+	if c.BaseURL != "" {
+		template = strings.Replace(template, "https://{portal_name}.udemy.com", strings.TrimSuffix(c.BaseURL, "/"), 1)
+	}
+
+	replacements := []string{"{portal_name}", c.PortalName}
+	for key, value := range params {
+		replacements = append(replacements, "{"+key+"}", url.QueryEscape(value))
+	}
+
+	return strings.NewReplacer(replacements...).Replace(template)
+}
+
+// Sends an authenticated GET request
+func (c *UdemyClient) Get(url string) (*http.Response, error) {
+	req, err := http.NewRequest(http.MethodGet, url, nil)
+	if err != nil {
+		return nil, err
+	}
+
+	req.Header.Set("Authorization", "Bearer "+c.Bearer)
+	req.Header.Set("X-Udemy-Authorization", "Bearer "+c.Bearer)
+	req.Header.Set("Accept", "application/json, text/plain, */*")
+	req.Header.Set("User-Agent", "udemy-dl-go/"+version)
+
+	return c.HTTPClient.Do(req)
+}
+
+// Sends an authenticated GET request and decodes the JSON response into v
+func (c *UdemyClient) GetJSON(url string, v interface{}) error {
+	Debugf("GET %s", url)
+	resp, err := c.Get(url)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		body, _ := io.ReadAll(io.LimitReader(resp.Body, 512))
+		return &UdemyAPIError{StatusCode: resp.StatusCode, Status: resp.Status, Body: string(body)}
+	}
+
+	return json.NewDecoder(resp.Body).Decode(v)
+}
+
+// Follows the "next" links of a paginated endpoint and calls fn with the results of every page
+func (c *UdemyClient) GetPaged(url string, fn func(results json.RawMessage) error) error {
+	for url != "" {
+		page := UdemyPagedResponse{}
+		err := c.GetJSON(url, &page)
+		if err != nil {
+			return err
+		}
+
+		err = fn(page.Results)
+		if err != nil {
+			return err
+		}
+
+		url = page.Next
+	}
+
+	return nil
+}
+
+func (c *UdemyClient) GetCourseInfo(courseID int) (*UdemyCourse, error) {
+	course := UdemyCourse{}
+	url := c.ExpandURL(COURSE_INFO_URL, map[string]string{"course_id": strconv.Itoa(courseID)})
+	err := c.GetJSON(url, &course)
+	if err != nil {
+		return nil, fmt.Errorf("Error getting course info: %s", err)
+	}
+
+	return &course, nil
+}
+
+// Gets the flat list of chapters, lectures and quizzes of a course
+func (c *UdemyClient) GetCurriculumItems(courseID int) ([]UdemyCurriculumItem, error) {
+	items := []UdemyCurriculumItem{}
+	url := c.ExpandURL(COURSE_URL, map[string]string{"course_id": strconv.Itoa(courseID)})
+	err := c.GetPaged(url, func(results json.RawMessage) error {
+		page := []UdemyCurriculumItem{}
+		if err := json.Unmarshal(results, &page); err != nil {
+			return err
+		}
+		items = append(items, page...)
+		return nil
+	})
+	if err != nil {
+		return nil, fmt.Errorf("Error getting course curriculum: %s", err)
+	}
+
+	return items, nil
+}
+
+// Gets a single lecture with fresh asset URLs, the URLs in the curriculum are signed and expire after a while
+func (c *UdemyClient) GetLecture(courseID, lectureID int) (*UdemyCurriculumItem, error) {
+	lecture := UdemyCurriculumItem{}
+	url := c.ExpandURL(LECTURE_URL, map[string]string{"course_id": strconv.Itoa(courseID), "lecture_id": strconv.Itoa(lectureID)})
+	err := c.GetJSON(url, &lecture)
+	if err != nil {
+		return nil, fmt.Errorf("Error getting lecture %d: %s", lectureID, err)
+	}
+
+	return &lecture, nil
+}
+
+// Gets all the courses the user is subscribed to
+func (c *UdemyClient) GetSubscribedCourses() ([]UdemyCourse, error) {
+	return c.getCourseList(c.ExpandURL(MY_COURSES_URL, nil))
+}
+
+// Searches the subscribed courses of the user by name
+func (c *UdemyClient) SearchSubscribedCourses(name string) ([]UdemyCourse, error) {
+	return c.getCourseList(c.ExpandURL(COURSE_SEARCH_URL, map[string]string{"course_name": name}))
+}
+
+func (c *UdemyClient) getCourseList(url string) ([]UdemyCourse, error) {
+	courses := []UdemyCourse{}
+	err := c.GetPaged(url, func(results json.RawMessage) error {
+		page := []UdemyCourse{}
+		if err := json.Unmarshal(results, &page); err != nil {
+			return err
+		}
+		courses = append(courses, page...)
+		return nil
+	})
+	if err != nil {
+		return nil, fmt.Errorf("Error getting subscribed courses: %s", err)
+	}
+
+	return courses, nil
+}
+
+// Returned when the API responds with a non 200 status
+type UdemyAPIError struct {
+	StatusCode int
+	Status     string
+	Body       string
+}
+
+func (e *UdemyAPIError) Error() string {
+	if e.StatusCode == http.StatusUnauthorized || e.StatusCode == http.StatusForbidden {
+		return fmt.Sprintf("%s (is your bearer token valid?)", e.Status)
+	}
+	return fmt.Sprintf("bad status: %s", e.Status)
+}
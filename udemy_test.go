@@ -0,0 +1,162 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func newTestUdemyClient(server *httptest.Server) *UdemyClient {
+	client := NewUdemyClient("secret-token", "acme")
+	client.BaseURL = server.URL
+	client.HTTPClient = server.Client()
+	return client
+}
+
+func TestExpandURL(t *testing.T) {
+	client := NewUdemyClient("token", "acme")
+
+	tests := []struct {
+		name     string
+		baseURL  string
+		template string
+		params   map[string]string
+		expected string
+	}{
+		{
+			name:     "portal name",
+			template: COURSE_INFO_URL,
+			params:   map[string]string{"course_id": "123"},
+			expected: "https://acme.udemy.com/api-2.0/courses/123/",
+		},
+		{
+			name:     "escaped parameters",
+			template: COURSE_SEARCH_URL,
+			params:   map[string]string{"course_name": "go & rust"},
+			expected: "https://acme.udemy.com/api-2.0/users/me/subscribed-courses?fields[course]=id,url,title,published_title&page=1&page_size=500&search=go+%26+rust",
+		},
+		{
+			name:     "base url",
+			baseURL:  "http://127.0.0.1:8080/",
+			template: LECTURE_URL,
+			params:   map[string]string{"course_id": "1", "lecture_id": "2"},
+			expected: "http://127.0.0.1:8080/api-2.0/users/me/subscribed-courses/1/lectures/2/?",
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			client.BaseURL = test.baseURL
+			got := client.ExpandURL(test.template, test.params)
+			if !strings.HasPrefix(got, test.expected) {
+				t.Errorf("got %s, expected it to start with %s", got, test.expected)
+			}
+			if strings.Contains(got, "{") {
+				t.Errorf("placeholders left in %s", got)
+			}
+		})
+	}
+}
+
+func TestUdemyClientAuthHeaders(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get("Authorization") != "Bearer secret-token" || r.Header.Get("X-Udemy-Authorization") != "Bearer secret-token" {
+			w.WriteHeader(http.StatusUnauthorized)
+			return
+		}
+		if r.URL.Path != "/api-2.0/courses/123/" {
+			w.WriteHeader(http.StatusNotFound)
+			return
+		}
+		fmt.Fprint(w, `{"_class":"course","id":123,"title":"Go","published_title":"go"}`)
+	}))
+	defer server.Close()
+
+	course, err := newTestUdemyClient(server).GetCourseInfo(123)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if course.ID != 123 || course.Title != "Go" || course.PublishedTitle != "go" {
+		t.Errorf("unexpected course: %+v", course)
+	}
+}
+
+func TestGetPagedFollowsNext(t *testing.T) {
+	var server *httptest.Server
+	server = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		page := UdemyPagedResponse{Count: 3}
+		switch r.URL.Query().Get("page") {
+		case "1":
+			page.Next = server.URL + r.URL.Path + "?page=2"
+			page.Results = json.RawMessage(`[{"id":1,"title":"One"},{"id":2,"title":"Two"}]`)
+		case "2":
+			page.Results = json.RawMessage(`[{"id":3,"title":"Three"}]`)
+		default:
+			w.WriteHeader(http.StatusBadRequest)
+			return
+		}
+		json.NewEncoder(w).Encode(page)
+	}))
+	defer server.Close()
+
+	courses, err := newTestUdemyClient(server).GetSubscribedCourses()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(courses) != 3 || courses[0].ID != 1 || courses[2].Title != "Three" {
+		t.Errorf("unexpected courses: %+v", courses)
+	}
+}
+
+func TestGetCurriculumItemsFixture(t *testing.T) {
+	server := httptest.NewServer(http.FileServer(http.Dir("testdata")))
+	defer server.Close()
+
+	client := newTestUdemyClient(server)
+	items := []UdemyCurriculumItem{}
+	err := client.GetPaged(server.URL+"/curriculum_items.json", func(results json.RawMessage) error {
+		return json.Unmarshal(results, &items)
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(items) != 10 || items[0].Class != "lecture" || items[1].Class != "chapter" {
+		t.Errorf("unexpected items: %d", len(items))
+	}
+}
+
+func TestUdemyAPIError(t *testing.T) {
+	tests := []struct {
+		status   int
+		expected string
+	}{
+		{http.StatusUnauthorized, "401 Unauthorized (is your bearer token valid?)"},
+		{http.StatusForbidden, "403 Forbidden (is your bearer token valid?)"},
+		{http.StatusNotFound, "bad status: 404 Not Found"},
+	}
+
+	for _, test := range tests {
+		t.Run(http.StatusText(test.status), func(t *testing.T) {
+			server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				w.WriteHeader(test.status)
+				fmt.Fprint(w, `{"detail":"nope"}`)
+			}))
+			defer server.Close()
+
+			err := newTestUdemyClient(server).GetJSON(server.URL+"/api-2.0/courses/1/", &UdemyCourse{})
+			apiErr, ok := err.(*UdemyAPIError)
+			if !ok {
+				t.Fatalf("expected a UdemyAPIError, got %v", err)
+			}
+			if apiErr.Error() != test.expected {
+				t.Errorf("got %q, expected %q", apiErr.Error(), test.expected)
+			}
+			if apiErr.StatusCode != test.status || apiErr.Body != `{"detail":"nope"}` {
+				t.Errorf("unexpected error fields: %+v", apiErr)
+			}
+		})
+	}
+}
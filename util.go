@@ -1,7 +1,11 @@
 package main
 
 import (
+	"context"
+	"encoding/hex"
+	"encoding/json"
 	"fmt"
+	"hash"
 	"io"
 	"io/ioutil"
 	"net/http"
@@ -9,15 +13,16 @@ import (
 	"os/exec"
 	"path"
 	"path/filepath"
+	"regexp"
+	"strconv"
 	"strings"
 
 	"github.com/k0kubun/go-ansi"
-	"github.com/saracen/go7z"
 
 	"github.com/schollz/progressbar/v3"
 )
 
-var httpClient = &http.Client{}
+var httpClient = &http.Client{Transport: httpRetryTransport}
 
 func GetUrl(url string) (*http.Response, error) {
 	return httpClient.Get(url)
@@ -53,6 +58,26 @@ func GetBytes(url string) ([]byte, error) {
 	return data, nil
 }
 
+// Same as GetBytes but cancellable, anything but 200 OK is an error
+func GetBytesContext(ctx context.Context, client *http.Client, url string) ([]byte, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, url, nil)
+	if err != nil {
+		return nil, err
+	}
+
+	resp, err := client.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("bad status: %s", resp.Status)
+	}
+
+	return io.ReadAll(resp.Body)
+}
+
 func EnsureDirExist(path string) error {
 	err := os.MkdirAll(path, os.ModePerm)
 	if err != nil {
@@ -99,101 +124,252 @@ func GetVersionFile(dir string) (string, error) {
 	return string(data), nil
 }
 
+// Creates the progress bar of a download once its size is known, a size of -1 means the size is unknown
+type ProgressFactory func(size int64) *progressbar.ProgressBar
+
 func DownloadFile(url, filepath string) (err error) {
+	return downloadFileWithBar(url, filepath, Checksum{}, -1)
+}
+
+// Same as DownloadFile but hashes the file while it downloads and deletes it if it doesn't match the expected SHA-256, an empty checksum skips the check
+func DownloadFileSHA256(url, filepath, expectedSHA256 string) (err error) {
+	return downloadFileWithBar(url, filepath, SHA256Checksum(expectedSHA256), -1)
+}
+
+// Same as DownloadFileSHA256 for an MD5 checksum
+func DownloadFileMD5(url, filepath, expectedMD5 string) error {
+	return downloadFileWithBar(url, filepath, MD5Checksum(expectedMD5), -1)
+}
+
+// Same as DownloadFile but uses sizeHint for the progress bar when the server doesn't send the size
+func DownloadFileSizeHint(url, filepath string, sizeHint int64) error {
+	return downloadFileWithBar(url, filepath, Checksum{}, sizeHint)
+}
+
+func downloadFileWithBar(url, filepath string, checksum Checksum, sizeHint int64) (err error) {
 	fname := path.Base(filepath)
+	var newBar ProgressFactory
+	if ShowProgress() {
+		newBar = func(size int64) *progressbar.ProgressBar {
+			if size <= 0 && sizeHint > 0 {
+				size = sizeHint
+			}
+			return NewDownloadBar(ansi.NewAnsiStdout(), size, fmt.Sprintf("[cyan][reset] Downloading %s...", fname))
+		}
+	}
 
-	// Get the data
-	resp, err := http.Get(url)
+	err = downloadFile(context.Background(), url, filepath, newBar, checksum)
 	if err != nil {
 		return err
 	}
+	if newBar != nil {
+		println("")
+	}
+
+	return nil
+}
+
+// Stored next to a .part file so a later run knows what it was resuming
+type partialDownload struct {
+	ETag string `json:"etag"`
+	Size int64  `json:"size"`
+}
+
+// Downloads a file into a .part file next to the destination and only renames it once it is complete.
+// An existing .part file is resumed with a Range request when the server supports it and the ETag still matches.
+func DownloadFileContext(ctx context.Context, url, filepath string, newBar ProgressFactory) error {
+	return downloadFile(ctx, url, filepath, newBar, Checksum{})
+}
+
+func downloadFile(ctx context.Context, url, filepath string, newBar ProgressFactory, checksum Checksum) error {
+	partPath := filepath + ".part"
+	metaPath := partPath + ".json"
+
+	var h hash.Hash
+	if checksum.Sum != "" {
+		h = checksum.newHash()
+	}
+
+	// a changed file on the server restarts the download once
+	for attempt := 0; attempt < 2; attempt++ {
+		if h != nil {
+			h.Reset()
+		}
+
+		restart, err := downloadPart(ctx, url, partPath, metaPath, newBar, h)
+		if err != nil {
+			return err
+		}
+		if restart {
+			Debugf("Restarting download of %s", path.Base(filepath))
+			os.Remove(partPath)
+			os.Remove(metaPath)
+			continue
+		}
+
+		os.Remove(metaPath)
+
+		if h != nil {
+			sum := hex.EncodeToString(h.Sum(nil))
+			if !strings.EqualFold(sum, checksum.Sum) {
+				os.Remove(partPath)
+				return fmt.Errorf("checksum mismatch for %s: expected %s %s but got %s, the file has been deleted", path.Base(filepath), checksum.Algorithm, checksum.Sum, sum)
+			}
+			Debugf("%s of %s verified: %s", checksum.Algorithm, path.Base(filepath), sum)
+		}
+
+		return os.Rename(partPath, filepath)
+	}
+
+	return fmt.Errorf("download of %s keeps changing on the server", path.Base(filepath))
+}
+
+// Downloads or resumes a single .part file, returns true if the partial data is unusable and the download has to start over
+func downloadPart(ctx context.Context, url, partPath, metaPath string, newBar ProgressFactory, h hash.Hash) (bool, error) {
+	var offset int64
+	meta := partialDownload{Size: -1}
+	if info, err := os.Stat(partPath); err == nil && info.Size() > 0 {
+		if data, err := ioutil.ReadFile(metaPath); err == nil && json.Unmarshal(data, &meta) == nil {
+			offset = info.Size()
+		}
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, url, nil)
+	if err != nil {
+		return false, err
+	}
+	if offset > 0 {
+		req.Header.Set("Range", fmt.Sprintf("bytes=%d-", offset))
+		if meta.ETag != "" {
+			req.Header.Set("If-Range", meta.ETag)
+		}
+	}
+
+	// Get the data
+	resp, err := httpClient.Do(req)
+	if err != nil {
+		return false, err
+	}
 	defer resp.Body.Close()
 
 	// Check server response
-	if resp.StatusCode != http.StatusOK {
-		return fmt.Errorf("bad status: %s", resp.Status)
+	total := resp.ContentLength
+	flags := os.O_CREATE | os.O_WRONLY | os.O_TRUNC
+	switch resp.StatusCode {
+	case http.StatusOK:
+		// the server ignored the range or the file changed, start from the beginning
+		if offset > 0 {
+			Debugf("Server sent the full file, discarding %d bytes of partial data", offset)
+		}
+		offset = 0
+	case http.StatusPartialContent:
+		start, size, err := parseContentRange(resp.Header.Get("Content-Range"))
+		if err != nil || start != offset {
+			return true, nil
+		}
+		if (meta.Size >= 0 && size >= 0 && size != meta.Size) || (meta.ETag != "" && resp.Header.Get("ETag") != "" && resp.Header.Get("ETag") != meta.ETag) {
+			return true, nil
+		}
+		total = size
+		flags = os.O_WRONLY | os.O_APPEND
+
+		// the hash has to cover the data we already have
+		if h != nil {
+			err = hashFile(partPath, h)
+			if err != nil {
+				return false, err
+			}
+		}
+	case http.StatusRequestedRangeNotSatisfiable:
+		// we might already have everything, the hash still has to cover it
+		if meta.Size >= 0 && offset == meta.Size {
+			if h != nil {
+				err = hashFile(partPath, h)
+				if err != nil {
+					return false, err
+				}
+			}
+			return false, nil
+		}
+		return true, nil
+	default:
+		return false, fmt.Errorf("bad status: %s", resp.Status)
+	}
+
+	// remember what we are downloading so the next run can resume it
+	meta = partialDownload{ETag: resp.Header.Get("ETag"), Size: total}
+	data, err := json.Marshal(meta)
+	if err != nil {
+		return false, err
+	}
+	err = ioutil.WriteFile(metaPath, data, 0644)
+	if err != nil {
+		return false, err
 	}
 
 	// Create the file
-	out, err := os.Create(filepath)
+	out, err := os.OpenFile(partPath, flags, 0644)
 	if err != nil {
-		return err
+		return false, err
+	}
+
+	writers := []io.Writer{out}
+	if newBar != nil {
+		bar := newBar(total)
+		if offset > 0 {
+			bar.Set64(offset)
+		}
+		writers = append(writers, bar)
+	}
+	if h != nil {
+		writers = append(writers, h)
 	}
-	defer out.Close()
-
-	bar := progressbar.NewOptions(int(resp.ContentLength),
-		progressbar.OptionSetWriter(ansi.NewAnsiStdout()),
-		progressbar.OptionEnableColorCodes(true),
-		progressbar.OptionShowBytes(true),
-		progressbar.OptionSetWidth(15),
-		progressbar.OptionSetDescription(fmt.Sprintf("[cyan][reset] Downloading %s...", fname)),
-		progressbar.OptionSetTheme(progressbar.Theme{
-			Saucer:        "[green]=[reset]",
-			SaucerHead:    "[green]>[reset]",
-			SaucerPadding: " ",
-			BarStart:      "[",
-			BarEnd:        "]",
-		}))
 
 	// Writer the body to file
-	_, err = io.Copy(io.MultiWriter(out, bar), resp.Body)
+	written, err := io.Copy(io.MultiWriter(writers...), resp.Body)
+	if closeErr := out.Close(); err == nil {
+		err = closeErr
+	}
 	if err != nil {
-		return err
+		return false, err
 	}
-	println("")
 
-	return nil
+	if total >= 0 && offset+written != total {
+		return false, fmt.Errorf("incomplete download: got %d of %d bytes", offset+written, total)
+	}
+
+	return false, nil
 }
 
-func DecompressWFilter(source, dest, remoteArchiveName string, filters []string) error {
-	sz, err := go7z.OpenReader(source)
+func hashFile(path string, h hash.Hash) error {
+	f, err := os.Open(path)
 	if err != nil {
 		return err
 	}
-	defer sz.Close()
-
-	for {
-		hdr, err := sz.Next()
-		if err == io.EOF {
-			break // End of archive
-		}
-		if err != nil {
-			return err
-		}
+	defer f.Close()
 
-		// remove root directory from path
-		hdr.Name = strings.TrimPrefix(hdr.Name, remoteArchiveName)
-
-		for _, filter := range filters {
-			if strings.HasPrefix(hdr.Name, filter) {
-				Debugf("%s matches filter %s", hdr.Name, filter)
-				fname := filepath.Base(hdr.Name)
-				p := filepath.Join(dest, fname)
-
-				// If empty stream (no contents) and isn't specifically an empty file...
-				// then it's a directory.
-				if hdr.IsEmptyStream && !hdr.IsEmptyFile {
-					if err := os.MkdirAll(p, os.ModePerm); err != nil {
-						return err
-					}
-					continue
-				}
+	_, err = io.Copy(h, f)
+	return err
+}
 
-				// Create file
-				f, err := os.Create(p)
-				if err != nil {
-					return err
-				}
-				defer f.Close()
+// Parses a "bytes start-end/size" header, size is -1 when the server doesn't know it
+func parseContentRange(header string) (int64, int64, error) {
+	var start, end int64
+	var size string
+	_, err := fmt.Sscanf(header, "bytes %d-%d/%s", &start, &end, &size)
+	if err != nil {
+		return 0, 0, fmt.Errorf("invalid Content-Range: %q", header)
+	}
 
-				if _, err := io.Copy(f, sz); err != nil {
-					return err
-				}
-			}
-		}
+	if size == "*" {
+		return start, -1, nil
+	}
+	total, err := strconv.ParseInt(size, 10, 64)
+	if err != nil {
+		return 0, 0, fmt.Errorf("invalid Content-Range: %q", header)
 	}
 
-	return nil
+	return start, total, nil
 }
 
 func WriteVersionFile(dir string, version string) error {
@@ -220,6 +396,45 @@ func ReadVersionFile(dir string) (string, error) {
 	return lines[1], nil
 }
 
+// Writes a file through a temporary file in the same directory so it never exists half written under its final name
+func WriteFileAtomic(path string, data []byte) error {
+	tmp, err := os.CreateTemp(filepath.Dir(path), filepath.Base(path)+".*.tmp")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmp.Name())
+
+	_, err = tmp.Write(data)
+	if closeErr := tmp.Close(); err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		return err
+	}
+
+	return os.Rename(tmp.Name(), path)
+}
+
+var invalidFilenameChars = regexp.MustCompile(`[<>:"/\\|?*\x00-\x1f]`)
+
+// Makes a string safe to use as a file or directory name on every OS
+func SanitizeFilename(name string) string {
+	name = invalidFilenameChars.ReplaceAllString(name, "_")
+	name = strings.Join(strings.Fields(name), " ")
+	// windows doesn't allow trailing dots or spaces
+	name = strings.TrimRight(name, ". ")
+
+	runes := []rune(name)
+	if len(runes) > 120 {
+		name = strings.TrimRight(string(runes[:120]), ". ")
+	}
+
+	if name == "" {
+		return "_"
+	}
+	return name
+}
+
 func CommandExists(cmd string) bool {
 	_, err := exec.LookPath(cmd)
 	return err == nil
@@ -0,0 +1,100 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+// Serves content with range support, like a CDN
+func newRangeServer(content []byte, ranges *[]string) *httptest.Server {
+	return httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		*ranges = append(*ranges, r.Header.Get("Range"))
+		w.Header().Set("ETag", `"abc"`)
+		http.ServeContent(w, r, "file", time.Time{}, bytes.NewReader(content))
+	}))
+}
+
+// Leaves a .part file with the first n bytes of content like an interrupted download
+func writePartialDownload(t *testing.T, dest string, content []byte, n int) {
+	t.Helper()
+
+	err := os.WriteFile(dest+".part", content[:n], 0644)
+	if err == nil {
+		err = os.WriteFile(dest+".part.json", []byte(`{"etag":"\"abc\"","size":10000}`), 0644)
+	}
+	if err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestDownloadFileResumesWithChecksum(t *testing.T) {
+	content := bytes.Repeat([]byte("0123456789"), 1000)
+	sum := sha256.Sum256(content)
+	checksum := hex.EncodeToString(sum[:])
+
+	tests := []struct {
+		name    string
+		partial int
+		ranges  []string
+	}{
+		{"partial", 4000, []string{"bytes=4000-"}},
+		// the server answers 416 when we already have everything
+		{"complete", 10000, []string{"bytes=10000-"}},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			ranges := []string{}
+			server := newRangeServer(content, &ranges)
+			defer server.Close()
+
+			dest := filepath.Join(t.TempDir(), "file.bin")
+			writePartialDownload(t, dest, content, test.partial)
+
+			err := downloadFile(context.Background(), server.URL, dest, nil, SHA256Checksum(checksum))
+			if err != nil {
+				t.Fatal(err)
+			}
+			data, _ := os.ReadFile(dest)
+			if !bytes.Equal(data, content) {
+				t.Errorf("got %d bytes", len(data))
+			}
+			if strings.Join(ranges, ",") != strings.Join(test.ranges, ",") {
+				t.Errorf("got ranges %v, expected %v", ranges, test.ranges)
+			}
+			if FileExists(dest+".part") || FileExists(dest+".part.json") {
+				t.Error("the partial download should have been cleaned up")
+			}
+		})
+	}
+}
+
+func TestDownloadFileCompletePartChecksumMismatch(t *testing.T) {
+	content := bytes.Repeat([]byte("0123456789"), 1000)
+	ranges := []string{}
+	server := newRangeServer(content, &ranges)
+	defer server.Close()
+
+	// a complete .part file that isn't what the checksum expects
+	tampered := bytes.Repeat([]byte("x"), len(content))
+	dest := filepath.Join(t.TempDir(), "file.bin")
+	writePartialDownload(t, dest, tampered, len(tampered))
+
+	sum := sha256.Sum256(content)
+	err := downloadFile(context.Background(), server.URL, dest, nil, SHA256Checksum(hex.EncodeToString(sum[:])))
+	if err == nil || !strings.Contains(err.Error(), "checksum mismatch") {
+		t.Fatalf("expected a checksum mismatch, got %v", err)
+	}
+	if FileExists(dest) || FileExists(dest+".part") {
+		t.Error("a file that doesn't match its checksum should be deleted")
+	}
+}
@@ -0,0 +1,101 @@
+package main
+
+import (
+	"bytes"
+	"crypto/md5"
+	"crypto/sha256"
+	"fmt"
+	"hash"
+	"os"
+	"regexp"
+	"strings"
+
+	"golang.org/x/crypto/openpgp"
+)
+
+var sha256Regex = regexp.MustCompile(`(?i)\b[0-9a-f]{64}\b`)
+var md5Regex = regexp.MustCompile(`(?i)\b[0-9a-f]{32}\b`)
+
+// A checksum a download has to match, the data is hashed while it downloads. An empty Sum skips the check.
+type Checksum struct {
+	// Algorithm is only used in messages, like SHA-256
+	Algorithm string
+	Sum       string
+	newHash   func() hash.Hash
+}
+
+func SHA256Checksum(sum string) Checksum {
+	return Checksum{Algorithm: "SHA-256", Sum: sum, newHash: sha256.New}
+}
+
+// MD5 is only used where nothing better is published
+func MD5Checksum(sum string) Checksum {
+	return Checksum{Algorithm: "MD5", Sum: sum, newHash: md5.New}
+}
+
+// Gets a published SHA-256 checksum, works for both bare hashes and "hash  filename" style files
+func GetPublishedSHA256(url string) (string, error) {
+	return getPublishedChecksum(url, sha256Regex, "SHA-256")
+}
+
+// Same as GetPublishedSHA256 for MD5 checksums
+func GetPublishedMD5(url string) (string, error) {
+	return getPublishedChecksum(url, md5Regex, "MD5")
+}
+
+func getPublishedChecksum(url string, regex *regexp.Regexp, algorithm string) (string, error) {
+	text, err := GetText(url)
+	if err != nil {
+		return "", err
+	}
+
+	sum := regex.FindString(text)
+	if sum == "" {
+		return "", fmt.Errorf("no %s checksum found at %s", algorithm, url)
+	}
+
+	return strings.ToLower(sum), nil
+}
+
+// Verifies a detached PGP signature of a file, the signing key is downloaded from keyURL and must have the expected key ID
+func VerifyPGPSignature(filepath, sigURL, keyURL string, keyID uint64) error {
+	keyData, err := GetBytes(keyURL)
+	if err != nil {
+		return fmt.Errorf("Error downloading signing key: %s", err)
+	}
+
+	keyring, err := openpgp.ReadArmoredKeyRing(bytes.NewReader(keyData))
+	if err != nil {
+		keyring, err = openpgp.ReadKeyRing(bytes.NewReader(keyData))
+		if err != nil {
+			return fmt.Errorf("Error reading signing key: %s", err)
+		}
+	}
+
+	sig, err := GetBytes(sigURL)
+	if err != nil {
+		return fmt.Errorf("Error downloading signature: %s", err)
+	}
+
+	file, err := os.Open(filepath)
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+
+	var signer *openpgp.Entity
+	if bytes.HasPrefix(bytes.TrimSpace(sig), []byte("-----BEGIN PGP")) {
+		signer, err = openpgp.CheckArmoredDetachedSignature(keyring, file, bytes.NewReader(sig))
+	} else {
+		signer, err = openpgp.CheckDetachedSignature(keyring, file, bytes.NewReader(sig))
+	}
+	if err != nil {
+		return fmt.Errorf("invalid signature: %s", err)
+	}
+
+	if signer.PrimaryKey.KeyId != keyID {
+		return fmt.Errorf("signed by unexpected key %X", signer.PrimaryKey.KeyId)
+	}
+
+	return nil
+}
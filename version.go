@@ -0,0 +1,228 @@
+package main
+
+import (
+	"fmt"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+)
+
+type VersionKind int
+
+const (
+	// Dotted release numbers like 5.1.2, v1.36.0 or the 2023.03.04 yt-dlp releases
+	VersionRelease VersionKind = iota
+	// FFMPEG master snapshots like N-109421-g9adf02247e, the number counts commits
+	VersionSnapshot
+	// Git builds from gyan.dev like 2023-01-30-git-2d202985b7
+	VersionGitDate
+)
+
+type Version struct {
+	Raw  string
+	Kind VersionKind
+	// Numbers are the dotted release numbers or the snapshot commit number
+	Numbers []int
+	// Prerelease is only set for alpha, beta, rc and dev releases, other suffixes like -0ubuntu1 or -static are ignored
+	Prerelease string
+	Date       time.Time
+	Hash       string
+}
+
+var (
+	releaseVersionRegex  = regexp.MustCompile(`^(?:release-|[vVn])?(\d+(?:\.\d+)*)(?:[-_+~](.*))?$`)
+	snapshotVersionRegex = regexp.MustCompile(`^N-(\d+)-g([0-9a-fA-F]+)`)
+	gitDateVersionRegex  = regexp.MustCompile(`^(\d{4}-\d{2}-\d{2})-git-([0-9a-fA-F]+)`)
+	prereleaseRegex      = regexp.MustCompile(`^(?i)(alpha|beta|rc|pre|dev)`)
+)
+
+func ParseVersion(raw string) (*Version, error) {
+	s := strings.TrimSpace(raw)
+	v := &Version{Raw: raw}
+
+	if match := snapshotVersionRegex.FindStringSubmatch(s); match != nil {
+		number, err := strconv.Atoi(match[1])
+		if err != nil {
+			return nil, fmt.Errorf("Invalid snapshot version %q: %s", raw, err)
+		}
+		v.Kind = VersionSnapshot
+		v.Numbers = []int{number}
+		v.Hash = strings.ToLower(match[2])
+		return v, nil
+	}
+
+	if match := gitDateVersionRegex.FindStringSubmatch(s); match != nil {
+		date, err := time.Parse("2006-01-02", match[1])
+		if err != nil {
+			return nil, fmt.Errorf("Invalid git version %q: %s", raw, err)
+		}
+		v.Kind = VersionGitDate
+		v.Date = date
+		v.Hash = strings.ToLower(match[2])
+		return v, nil
+	}
+
+	if match := releaseVersionRegex.FindStringSubmatch(s); match != nil {
+		for _, part := range strings.Split(match[1], ".") {
+			number, err := strconv.Atoi(part)
+			if err != nil {
+				return nil, fmt.Errorf("Invalid version %q: %s", raw, err)
+			}
+			v.Numbers = append(v.Numbers, number)
+		}
+		if prereleaseRegex.MatchString(match[2]) {
+			v.Prerelease = strings.ToLower(match[2])
+		}
+		v.Kind = VersionRelease
+		return v, nil
+	}
+
+	return nil, fmt.Errorf("Unknown version format: %q", raw)
+}
+
+// Returns -1, 0 or 1 like strings.Compare, versions of different kinds can't be compared
+func (v *Version) Compare(other *Version) (int, error) {
+	if v.Kind != other.Kind {
+		return 0, fmt.Errorf("Can't compare versions %q and %q, they use different formats", v.Raw, other.Raw)
+	}
+
+	switch v.Kind {
+	case VersionGitDate:
+		if v.Date.Before(other.Date) {
+			return -1, nil
+		}
+		if v.Date.After(other.Date) {
+			return 1, nil
+		}
+		return 0, nil
+	case VersionRelease:
+		if c := compareNumbers(v.Numbers, other.Numbers); c != 0 {
+			return c, nil
+		}
+		// a prerelease comes before the release itself
+		switch {
+		case v.Prerelease == other.Prerelease:
+			return 0, nil
+		case v.Prerelease == "":
+			return 1, nil
+		case other.Prerelease == "":
+			return -1, nil
+		}
+		return strings.Compare(v.Prerelease, other.Prerelease), nil
+	}
+
+	return compareNumbers(v.Numbers, other.Numbers), nil
+}
+
+// Compares dotted numbers, missing parts count as 0 so 5.1 equals 5.1.0
+func compareNumbers(a, b []int) int {
+	for i := 0; i < len(a) || i < len(b); i++ {
+		var x, y int
+		if i < len(a) {
+			x = a[i]
+		}
+		if i < len(b) {
+			y = b[i]
+		}
+		if x < y {
+			return -1
+		}
+		if x > y {
+			return 1
+		}
+	}
+	return 0
+}
+
+func CompareVersions(a, b string) (int, error) {
+	va, err := ParseVersion(a)
+	if err != nil {
+		return 0, err
+	}
+
+	vb, err := ParseVersion(b)
+	if err != nil {
+		return 0, err
+	}
+
+	return va.Compare(vb)
+}
+
+// Whether latestVersion is newer than currentVersion, versions that can't be compared are outdated when they differ
+func IsOutdated(currentVersion, latestVersion string) bool {
+	c, err := CompareVersions(currentVersion, latestVersion)
+	if err != nil {
+		Debugf("%s, treating them as different versions", err)
+		return currentVersion != latestVersion
+	}
+
+	return c < 0
+}
+
+type VersionPolicyMode int
+
+const (
+	// Always update to the latest version
+	VersionPolicyLatest VersionPolicyMode = iota
+	// Use exactly this version
+	VersionPolicyPinned
+	// Any version from this one on is fine, it is only updated when older
+	VersionPolicyMinimum
+)
+
+type VersionPolicy struct {
+	Mode    VersionPolicyMode
+	Version string
+}
+
+// Parses "latest", "1.2.3" (pinned) or ">=1.2.3" (minimum), an empty string means latest
+func ParseVersionPolicy(s string) (VersionPolicy, error) {
+	s = strings.TrimSpace(s)
+
+	policy := VersionPolicy{Mode: VersionPolicyLatest}
+	switch {
+	case s == "" || s == "latest":
+		return policy, nil
+	case strings.HasPrefix(s, ">="):
+		policy.Mode = VersionPolicyMinimum
+		policy.Version = strings.TrimSpace(strings.TrimPrefix(s, ">="))
+	default:
+		policy.Mode = VersionPolicyPinned
+		policy.Version = strings.TrimPrefix(s, "=")
+	}
+
+	_, err := ParseVersion(policy.Version)
+	if err != nil {
+		return policy, err
+	}
+
+	return policy, nil
+}
+
+// Whether the current version is acceptable without looking up the latest one, the latest policy always needs a lookup
+func (p VersionPolicy) Satisfied(currentVersion string) bool {
+	switch p.Mode {
+	case VersionPolicyPinned:
+		if currentVersion == p.Version {
+			return true
+		}
+		c, err := CompareVersions(currentVersion, p.Version)
+		return err == nil && c == 0
+	case VersionPolicyMinimum:
+		c, err := CompareVersions(currentVersion, p.Version)
+		return err == nil && c >= 0
+	}
+
+	return false
+}
+
+func (p VersionPolicy) String() string {
+	switch p.Mode {
+	case VersionPolicyPinned:
+		return p.Version
+	case VersionPolicyMinimum:
+		return ">=" + p.Version
+	}
+	return "latest"
+}
@@ -0,0 +1,191 @@
+package main
+
+import (
+	"reflect"
+	"testing"
+	"time"
+)
+
+func TestParseVersion(t *testing.T) {
+	tests := []struct {
+		raw        string
+		kind       VersionKind
+		numbers    []int
+		prerelease string
+		date       string
+		hash       string
+	}{
+		{raw: "9.0", kind: VersionRelease, numbers: []int{9, 0}},
+		{raw: "10.0", kind: VersionRelease, numbers: []int{10, 0}},
+		{raw: "v1.36.0", kind: VersionRelease, numbers: []int{1, 36, 0}},
+		{raw: "release-1.37.0", kind: VersionRelease, numbers: []int{1, 37, 0}},
+		{raw: "n5.1.2", kind: VersionRelease, numbers: []int{5, 1, 2}},
+		{raw: "6.0-static", kind: VersionRelease, numbers: []int{6, 0}},
+		{raw: "4.4.2-0ubuntu0.22.04.1", kind: VersionRelease, numbers: []int{4, 4, 2}},
+		{raw: "2023.03.04", kind: VersionRelease, numbers: []int{2023, 3, 4}},
+		{raw: "7.0-rc1", kind: VersionRelease, numbers: []int{7, 0}, prerelease: "rc1"},
+		{raw: "1.2.0-beta.2", kind: VersionRelease, numbers: []int{1, 2, 0}, prerelease: "beta.2"},
+		{raw: "N-109421-g9adf02247e", kind: VersionSnapshot, numbers: []int{109421}, hash: "9adf02247e"},
+		{raw: "N-111806-gF0b3eee0ae-tessus", kind: VersionSnapshot, numbers: []int{111806}, hash: "f0b3eee0ae"},
+		{raw: "2023-01-30-git-2d202985b7", kind: VersionGitDate, date: "2023-01-30", hash: "2d202985b7"},
+		{raw: " 5.1 ", kind: VersionRelease, numbers: []int{5, 1}},
+	}
+
+	for _, test := range tests {
+		t.Run(test.raw, func(t *testing.T) {
+			v, err := ParseVersion(test.raw)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if v.Kind != test.kind || v.Prerelease != test.prerelease || v.Hash != test.hash {
+				t.Errorf("got %+v", v)
+			}
+			if test.numbers != nil && !reflect.DeepEqual(v.Numbers, test.numbers) {
+				t.Errorf("got numbers %v, expected %v", v.Numbers, test.numbers)
+			}
+			if test.date != "" && v.Date.Format("2006-01-02") != test.date {
+				t.Errorf("got date %s, expected %s", v.Date.Format(time.RFC3339), test.date)
+			}
+		})
+	}
+}
+
+func TestParseVersionInvalid(t *testing.T) {
+	for _, raw := range []string{"", "latest", "git-master", "N-abc-g123", "2023-13-45-git-abcdef"} {
+		if v, err := ParseVersion(raw); err == nil {
+			t.Errorf("expected an error for %q, got %+v", raw, v)
+		}
+	}
+}
+
+func TestCompareVersions(t *testing.T) {
+	tests := []struct {
+		a, b     string
+		expected int
+		err      bool
+	}{
+		{a: "9.0", b: "10.0", expected: -1},
+		{a: "10.0", b: "9.0", expected: 1},
+		{a: "5.1", b: "5.1.0", expected: 0},
+		{a: "n5.1.2", b: "5.1.2", expected: 0},
+		{a: "6.0-static", b: "6.0", expected: 0},
+		{a: "5.1.2", b: "6.0-static", expected: -1},
+		{a: "v1.36.0", b: "release-1.37.0", expected: -1},
+		{a: "2023.03.04", b: "2023.11.16", expected: -1},
+		{a: "7.0-rc1", b: "7.0", expected: -1},
+		{a: "7.0", b: "7.0-rc1", expected: 1},
+		{a: "7.0-beta1", b: "7.0-rc1", expected: -1},
+		{a: "7.0-rc1", b: "6.1", expected: 1},
+		{a: "N-109421-g9adf02247e", b: "N-110000-gabcdef1234", expected: -1},
+		{a: "N-99999-gabcdef1234", b: "N-100000-g9adf02247e", expected: -1},
+		{a: "N-109421-g9adf02247e", b: "N-109421-g9adf02247e", expected: 0},
+		{a: "2023-01-30-git-2d202985b7", b: "2022-12-25-git-eb3ec3e8f7", expected: 1},
+		{a: "2023-01-30-git-2d202985b7", b: "2023-01-30-git-aaaaaaaaaa", expected: 0},
+		// different formats can't be ordered
+		{a: "N-109421-g9adf02247e", b: "5.1.2", err: true},
+		{a: "2023-01-30-git-2d202985b7", b: "N-109421-g9adf02247e", err: true},
+		{a: "6.0", b: "2023-01-30-git-2d202985b7", err: true},
+		{a: "6.0", b: "latest", err: true},
+	}
+
+	for _, test := range tests {
+		t.Run(test.a+" vs "+test.b, func(t *testing.T) {
+			got, err := CompareVersions(test.a, test.b)
+			if test.err {
+				if err == nil {
+					t.Errorf("expected an error, got %d", got)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			if got != test.expected {
+				t.Errorf("got %d, expected %d", got, test.expected)
+			}
+		})
+	}
+}
+
+func TestIsOutdated(t *testing.T) {
+	tests := []struct {
+		current, latest string
+		expected        bool
+	}{
+		{"9.0", "10.0", true},
+		{"10.0", "9.0", false},
+		{"6.0", "6.0", false},
+		// mixed formats fall back to a plain comparison
+		{"N-109421-g9adf02247e", "6.0", true},
+		{"unknown", "unknown", false},
+	}
+
+	for _, test := range tests {
+		if got := IsOutdated(test.current, test.latest); got != test.expected {
+			t.Errorf("IsOutdated(%q, %q) = %v, expected %v", test.current, test.latest, got, test.expected)
+		}
+	}
+}
+
+func TestParseVersionPolicy(t *testing.T) {
+	tests := []struct {
+		raw      string
+		expected VersionPolicy
+		err      bool
+	}{
+		{raw: "", expected: VersionPolicy{Mode: VersionPolicyLatest}},
+		{raw: "latest", expected: VersionPolicy{Mode: VersionPolicyLatest}},
+		{raw: "5.1.2", expected: VersionPolicy{Mode: VersionPolicyPinned, Version: "5.1.2"}},
+		{raw: "=5.1.2", expected: VersionPolicy{Mode: VersionPolicyPinned, Version: "5.1.2"}},
+		{raw: ">= 1.36.0", expected: VersionPolicy{Mode: VersionPolicyMinimum, Version: "1.36.0"}},
+		{raw: "newest", err: true},
+		{raw: ">=", err: true},
+	}
+
+	for _, test := range tests {
+		t.Run(test.raw, func(t *testing.T) {
+			policy, err := ParseVersionPolicy(test.raw)
+			if test.err {
+				if err == nil {
+					t.Errorf("expected an error, got %+v", policy)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			if policy != test.expected {
+				t.Errorf("got %+v, expected %+v", policy, test.expected)
+			}
+		})
+	}
+}
+
+func TestVersionPolicySatisfied(t *testing.T) {
+	tests := []struct {
+		policy   VersionPolicy
+		current  string
+		expected bool
+	}{
+		{VersionPolicy{Mode: VersionPolicyLatest}, "6.0", false},
+		{VersionPolicy{Mode: VersionPolicyPinned, Version: "5.1.2"}, "5.1.2", true},
+		{VersionPolicy{Mode: VersionPolicyPinned, Version: "5.1.2"}, "n5.1.2", true},
+		{VersionPolicy{Mode: VersionPolicyPinned, Version: "5.1"}, "5.1.0", true},
+		{VersionPolicy{Mode: VersionPolicyPinned, Version: "5.1.2"}, "5.1.3", false},
+		{VersionPolicy{Mode: VersionPolicyPinned, Version: "N-109421-g9adf02247e"}, "N-109421-g9adf02247e", true},
+		{VersionPolicy{Mode: VersionPolicyPinned, Version: "5.1.2"}, "N-109421-g9adf02247e", false},
+		{VersionPolicy{Mode: VersionPolicyMinimum, Version: "5.1"}, "6.0-static", true},
+		{VersionPolicy{Mode: VersionPolicyMinimum, Version: "5.1"}, "5.1", true},
+		{VersionPolicy{Mode: VersionPolicyMinimum, Version: "9.0"}, "10.0", true},
+		{VersionPolicy{Mode: VersionPolicyMinimum, Version: "10.0"}, "9.0", false},
+		{VersionPolicy{Mode: VersionPolicyMinimum, Version: "5.1"}, "2023-01-30-git-2d202985b7", false},
+	}
+
+	for _, test := range tests {
+		t.Run(test.policy.String()+" "+test.current, func(t *testing.T) {
+			if got := test.policy.Satisfied(test.current); got != test.expected {
+				t.Errorf("got %v, expected %v", got, test.expected)
+			}
+		})
+	}
+}
@@ -0,0 +1,203 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"runtime"
+	"strings"
+
+	"github.com/google/go-github/v43/github"
+)
+
+type YtdlpDependency struct {
+	Dir    string
+	Owner  string
+	Repo   string
+	GitHub *github.Client
+
+	// the release found by LatestVersion with its download and checksum URLs
+	latestVersion string
+	latestUrl     string
+	sumsUrl       string
+}
+
+func NewYtdlpDependency() *YtdlpDependency {
+	return &YtdlpDependency{Dir: YTDLP_BIN_DIRECTORY, Owner: YTDLP_REPO_OWNER, Repo: YTDLP_REPO_NAME, GitHub: githubClient}
+}
+
+func (d *YtdlpDependency) Name() string {
+	return "yt-dlp"
+}
+
+func (d *YtdlpDependency) BinaryPath() string {
+	return filepath.Join(d.Dir, ytdlpBinaryName())
+}
+
+func (d *YtdlpDependency) Version(binary string) (string, error) {
+	return GetYtdlpVersion(binary)
+}
+
+func (d *YtdlpDependency) Detect() (*DependencyInstall, error) {
+	// check if yt-dlp is installed externally
+	if CommandExists("yt-dlp") {
+		return detectSystemInstall("yt-dlp", GetYtdlpVersion), nil
+	}
+
+	return detectManagedInstall(d.Dir, d.BinaryPath())
+}
+
+func (d *YtdlpDependency) LatestVersion() (string, error) {
+	release, err := GetLatestRelease(d.GitHub, d.Owner, d.Repo)
+	if err != nil {
+		return "", err
+	}
+
+	url, sumsUrl, err := GetYtdlpReleaseDownload(d.GitHub, d.Owner, d.Repo, release)
+	if err != nil {
+		return "", err
+	}
+
+	d.latestVersion = release.GetTagName()
+	d.latestUrl = url
+	d.sumsUrl = sumsUrl
+	return d.latestVersion, nil
+}
+
+// The binary is replaced in place, there is nothing else in the directory to clean up
+func (d *YtdlpDependency) Install(version string) error {
+	url, sumsUrl := d.latestUrl, d.sumsUrl
+	if version != d.latestVersion {
+		release, err := GetReleaseByTag(d.GitHub, d.Owner, d.Repo, version)
+		if err != nil {
+			return fmt.Errorf("Error getting yt-dlp release %s: %s", version, err)
+		}
+
+		url, sumsUrl, err = GetYtdlpReleaseDownload(d.GitHub, d.Owner, d.Repo, release)
+		if err != nil {
+			return err
+		}
+	}
+
+	err := EnsureDirExist(d.Dir)
+	if err != nil {
+		return fmt.Errorf("Error creating yt-dlp directory: %s", err)
+	}
+
+	return DownloadYtdlp(version, url, sumsUrl, d.Dir)
+}
+
+func ytdlpBinaryName() string {
+	if runtime.GOOS == "windows" {
+		return "yt-dlp.exe"
+	}
+	return "yt-dlp"
+}
+
+// Runs yt-dlp --version, it prints nothing but the version
+func GetYtdlpVersion(binary string) (string, error) {
+	out, err := exec.Command(binary, "--version").Output()
+	if err != nil {
+		return "", err
+	}
+
+	return strings.TrimSpace(string(out)), nil
+}
+
+// Name of the release asset for the current platform
+func GetYtdlpAssetName() (string, error) {
+	switch runtime.GOOS + "/" + runtime.GOARCH {
+	case "windows/amd64":
+		return "yt-dlp.exe", nil
+	case "windows/386":
+		return "yt-dlp_x86.exe", nil
+	case "darwin/amd64", "darwin/arm64":
+		return "yt-dlp_macos", nil
+	case "linux/amd64":
+		return "yt-dlp_linux", nil
+	case "linux/arm64":
+		return "yt-dlp_linux_aarch64", nil
+	case "linux/arm":
+		return "yt-dlp_linux_armv7l", nil
+	}
+
+	return "", fmt.Errorf("There are no yt-dlp builds for %s/%s, please install yt-dlp via your systems package manager or pip and re-run the script", runtime.GOOS, runtime.GOARCH)
+}
+
+// Returns the download URL of the build for this platform in a yt-dlp release and the URL of its checksum file
+func GetYtdlpReleaseDownload(gh *github.Client, owner, repo string, release *github.RepositoryRelease) (string, string, error) {
+	assetName, err := GetYtdlpAssetName()
+	if err != nil {
+		return "", "", err
+	}
+
+	assets, err := GetReleaseAssets(gh, owner, repo, release.GetID())
+	if err != nil {
+		return "", "", err
+	}
+
+	var url, sumsUrl string
+	for _, asset := range assets {
+		switch asset.GetName() {
+		case assetName:
+			url = asset.GetBrowserDownloadURL()
+		case "SHA2-256SUMS":
+			sumsUrl = asset.GetBrowserDownloadURL()
+		}
+	}
+
+	if url == "" {
+		return "", "", fmt.Errorf("No %s found in yt-dlp release %s", assetName, release.GetTagName())
+	}
+
+	return url, sumsUrl, nil
+}
+
+// Finds the checksum of a file in a "hash  filename" list
+func findChecksum(sums, filename string) string {
+	for _, line := range strings.Split(sums, "\n") {
+		fields := strings.Fields(line)
+		if len(fields) == 2 && strings.TrimPrefix(fields[1], "*") == filename {
+			return strings.ToLower(fields[0])
+		}
+	}
+	return ""
+}
+
+func DownloadYtdlp(version, url, sumsUrl, dir string) error {
+	var err error
+
+	checksum := ""
+	if sumsUrl != "" {
+		sums, err := GetText(sumsUrl)
+		if err != nil {
+			return fmt.Errorf("Error getting yt-dlp checksums: %s", err)
+		}
+		checksum = findChecksum(sums, filepath.Base(url))
+	}
+	if checksum == "" {
+		Warning("No checksum published for this yt-dlp build, it can't be verified")
+	}
+
+	// Download yt-dlp, it is a single executable
+	binaryPath := filepath.Join(dir, ytdlpBinaryName())
+	Debugf("Downloading yt-dlp from: %s", url)
+	err = DownloadFileSHA256(url, binaryPath, checksum)
+	if err != nil {
+		return fmt.Errorf("Error downloading yt-dlp: %s", err)
+	}
+
+	err = os.Chmod(binaryPath, 0755)
+	if err != nil {
+		return fmt.Errorf("Error making yt-dlp executable: %s", err)
+	}
+
+	Debug("Writing yt-dlp Version file...")
+	err = WriteVersionFile(dir, version)
+	if err != nil {
+		return fmt.Errorf("Error writing yt-dlp version file: %s", err)
+	}
+
+	return nil
+}
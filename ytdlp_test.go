@@ -0,0 +1,134 @@
+package main
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"strings"
+	"testing"
+)
+
+// Serves two yt-dlp releases from a fake GitHub API, sums is the SHA2-256SUMS content
+func newYtdlpServer(t *testing.T, assetName, binary string, sums func(string) string) *httptest.Server {
+	t.Helper()
+
+	mux := http.NewServeMux()
+	server := httptest.NewServer(mux)
+	release := func(id int, tag string) func(w http.ResponseWriter, r *http.Request) {
+		return func(w http.ResponseWriter, r *http.Request) {
+			fmt.Fprintf(w, `{"id": %d, "tag_name": %q}`, id, tag)
+		}
+	}
+	assets := func(w http.ResponseWriter, r *http.Request) {
+		fmt.Fprintf(w, `[{"name": %q, "browser_download_url": %q}, {"name": "SHA2-256SUMS", "browser_download_url": %q}]`,
+			assetName, server.URL+"/download/"+assetName, server.URL+"/download/SHA2-256SUMS")
+	}
+
+	mux.HandleFunc("/repos/yt-dlp/yt-dlp/releases/latest", release(2, "2023.11.16"))
+	mux.HandleFunc("/repos/yt-dlp/yt-dlp/releases/tags/2023.10.13", release(1, "2023.10.13"))
+	mux.HandleFunc("/repos/yt-dlp/yt-dlp/releases/1/assets", assets)
+	mux.HandleFunc("/repos/yt-dlp/yt-dlp/releases/2/assets", assets)
+	mux.HandleFunc("/download/"+assetName, func(w http.ResponseWriter, r *http.Request) {
+		fmt.Fprint(w, binary)
+	})
+	mux.HandleFunc("/download/SHA2-256SUMS", func(w http.ResponseWriter, r *http.Request) {
+		fmt.Fprint(w, sums(binary))
+	})
+	return server
+}
+
+func newTestYtdlpDependency(t *testing.T, server *httptest.Server) *YtdlpDependency {
+	d := NewYtdlpDependency()
+	d.Dir = t.TempDir()
+	d.GitHub = newTestGitHubClient(t, server)
+	return d
+}
+
+func TestYtdlpDependencyInstall(t *testing.T) {
+	assetName, err := GetYtdlpAssetName()
+	if err != nil {
+		t.Skip(err)
+	}
+
+	binary := "#!/bin/sh\necho yt-dlp\n"
+	server := newYtdlpServer(t, assetName, binary, func(binary string) string {
+		sum := sha256.Sum256([]byte(binary))
+		return fmt.Sprintf("%s  yt-dlp.tar.gz\n%s  %s\n", strings.Repeat("0", 64), hex.EncodeToString(sum[:]), assetName)
+	})
+	defer server.Close()
+
+	tests := []struct {
+		name    string
+		version string
+	}{
+		{"latest", "2023.11.16"},
+		{"pinned", "2023.10.13"},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			d := newTestYtdlpDependency(t, server)
+
+			latest, err := d.LatestVersion()
+			if err != nil || latest != "2023.11.16" {
+				t.Fatalf("got latest version %q: %v", latest, err)
+			}
+
+			err = d.Install(test.version)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			data, err := os.ReadFile(d.BinaryPath())
+			if err != nil || string(data) != binary {
+				t.Errorf("unexpected binary %q: %v", data, err)
+			}
+			version, err := ReadVersionFile(d.Dir)
+			if err != nil || version != test.version {
+				t.Errorf("got version %q (%v), expected %s", version, err, test.version)
+			}
+		})
+	}
+}
+
+func TestYtdlpDependencyChecksumMismatch(t *testing.T) {
+	assetName, err := GetYtdlpAssetName()
+	if err != nil {
+		t.Skip(err)
+	}
+
+	server := newYtdlpServer(t, assetName, "tampered", func(string) string {
+		return fmt.Sprintf("%s  %s\n", strings.Repeat("ab", 32), assetName)
+	})
+	defer server.Close()
+
+	d := newTestYtdlpDependency(t, server)
+	_, err = d.LatestVersion()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	err = d.Install("2023.11.16")
+	if err == nil || !strings.Contains(err.Error(), "checksum mismatch") {
+		t.Fatalf("expected a checksum mismatch, got %v", err)
+	}
+	if FileExists(d.BinaryPath()) || VersionFileExists(d.Dir) {
+		t.Error("a binary that doesn't match its checksum shouldn't be installed")
+	}
+}
+
+func TestFindChecksum(t *testing.T) {
+	sums := "AAAA  yt-dlp\nbbbb *yt-dlp_linux\n\ncccc  yt-dlp_macos\n"
+	if sum := findChecksum(sums, "yt-dlp_linux"); sum != "bbbb" {
+		t.Errorf("got %q", sum)
+	}
+	if sum := findChecksum(sums, "yt-dlp"); sum != "aaaa" {
+		t.Errorf("got %q", sum)
+	}
+	if sum := findChecksum(sums, "yt-dlp_x86.exe"); sum != "" {
+		t.Errorf("got %q", sum)
+	}
+}